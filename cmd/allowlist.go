@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+// ignoreFileName is the repository-level allowlist, read from the repo root
+const ignoreFileName = ".secretsantaignore"
+
+// inlineAllowMarker suppresses findings on the line it appears on
+const inlineAllowMarker = "secretsanta:allow"
+
+// Reasons recorded in SecretMatch.Suppressed
+const (
+	suppressedInline      = "inline"
+	suppressedFingerprint = "fingerprint"
+	suppressedPath        = "path"
+	suppressedPattern     = "pattern"
+	suppressedCommit      = "commit"
+)
+
+// allowlist holds suppression rules from .secretsantaignore or the global
+// allowlist file. Each non-empty line that isn't a comment is one rule:
+//
+//	fingerprint:sha256:<hex>   a secret value, as printed in reports
+//	path:<glob>                files matching the glob; ** spans directories
+//	pattern:<name>             every finding of a rule, by name or id
+//	commit:<hash>              a commit, abbreviated hashes allowed
+//	<glob>                     same as path:<glob>
+type allowlist struct {
+	fingerprints map[string]bool
+	paths        []*regexp.Regexp
+	patterns     map[string]bool
+	commits      []string
+}
+
+// newAllowlist returns an empty allowlist
+func newAllowlist() *allowlist {
+	return &allowlist{
+		fingerprints: make(map[string]bool),
+		patterns:     make(map[string]bool),
+	}
+}
+
+// parseAllowlist reads allowlist rules, one per line
+func parseAllowlist(data string) (*allowlist, error) {
+	a := newAllowlist()
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, value := "path", line
+		if i := strings.Index(line, ":"); i > 0 {
+			switch line[:i] {
+			case "fingerprint", "path", "pattern", "commit":
+				kind, value = line[:i], strings.TrimSpace(line[i+1:])
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("line %d: empty %s rule", lineNo, kind)
+		}
+
+		switch kind {
+		case "fingerprint":
+			value = strings.ToLower(value)
+			if !strings.HasPrefix(value, "sha256:") {
+				value = "sha256:" + value
+			}
+			a.fingerprints[value] = true
+		case "path":
+			a.paths = append(a.paths, globToRegexp(value))
+		case "pattern":
+			a.patterns[value] = true
+		case "commit":
+			if len(value) < 7 {
+				return nil, fmt.Errorf("line %d: commit hash %q is too short", lineNo, value)
+			}
+			a.commits = append(a.commits, strings.ToLower(value))
+		}
+	}
+
+	return a, scanner.Err()
+}
+
+// loadAllowlistFile reads an allowlist file; a missing file is an empty allowlist
+func loadAllowlistFile(path string) (*allowlist, error) {
+	if path == "" {
+		return newAllowlist(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newAllowlist(), nil
+		}
+		return nil, err
+	}
+
+	a, err := parseAllowlist(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return a, nil
+}
+
+// loadRepoAllowlist reads .secretsantaignore from a repository, preferring the
+// working tree copy and falling back to the one committed at HEAD
+func loadRepoAllowlist(repo *git.Repository, repoPath string) (*allowlist, error) {
+	if data, err := os.ReadFile(filepath.Join(repoPath, ignoreFileName)); err == nil {
+		return parseAllowlist(string(data))
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return newAllowlist(), nil
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return newAllowlist(), nil
+	}
+
+	file, err := commit.File(ignoreFileName)
+	if err != nil {
+		return newAllowlist(), nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAllowlist(content)
+}
+
+// merge returns an allowlist with the rules of both a and b
+func (a *allowlist) merge(b *allowlist) *allowlist {
+	merged := newAllowlist()
+	for _, src := range []*allowlist{a, b} {
+		if src == nil {
+			continue
+		}
+		for fp := range src.fingerprints {
+			merged.fingerprints[fp] = true
+		}
+		for name := range src.patterns {
+			merged.patterns[name] = true
+		}
+		merged.paths = append(merged.paths, src.paths...)
+		merged.commits = append(merged.commits, src.commits...)
+	}
+	return merged
+}
+
+// suppress returns why a finding is suppressed, or "" if it isn't
+func (a *allowlist) suppress(match SecretMatch) string {
+	if a == nil {
+		return ""
+	}
+
+	if a.fingerprints[secretFingerprint(match.Secret)] {
+		return suppressedFingerprint
+	}
+	if a.patterns[match.PatternName] || match.RuleID != "" && a.patterns[match.RuleID] {
+		return suppressedPattern
+	}
+	for _, prefix := range a.commits {
+		if strings.HasPrefix(match.CommitHash, prefix) {
+			return suppressedCommit
+		}
+	}
+	for _, re := range a.paths {
+		if re.MatchString(match.FilePath) {
+			return suppressedPath
+		}
+	}
+	return ""
+}
+
+// globToRegexp converts a path glob to a regular expression. "*" and "?"
+// don't cross "/", "**" does, and a glob without "/" matches in any directory.
+func globToRegexp(glob string) *regexp.Regexp {
+	// A trailing "/" only marks a directory, which the glob covers anyway
+	glob = strings.TrimSuffix(strings.TrimPrefix(glob, "/"), "/")
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A directory glob also covers everything below it
+	b.WriteString("(?:/.*)?$")
+
+	return regexp.MustCompile(b.String())
+}
+
+// splitSuppressed separates active findings from suppressed ones
+func splitSuppressed(findings []SecretMatch) (active, suppressed []SecretMatch) {
+	for _, match := range findings {
+		if match.Suppressed != "" {
+			suppressed = append(suppressed, match)
+		} else {
+			active = append(active, match)
+		}
+	}
+	return active, suppressed
+}
+
+// suppressedCounts counts suppressed findings by reason
+func suppressedCounts(suppressed []SecretMatch) map[string]int {
+	if len(suppressed) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, match := range suppressed {
+		counts[match.Suppressed]++
+	}
+	return counts
+}
+
+// suppressedSummary describes suppressed findings, e.g. "3 (path: 2, inline: 1)"
+func suppressedSummary(suppressed []SecretMatch) string {
+	counts := suppressedCounts(suppressed)
+
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%s: %d", reason, counts[reason]))
+	}
+
+	if len(parts) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", len(suppressed), strings.Join(parts, ", "))
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseAllowlistErrors(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr bool
+	}{
+		{"# comment\n\n", false},
+		{"fingerprint:sha256:abc\npath:vendor/\npattern:aws-access-key\ncommit:1234567\n*.lock", false},
+		{"path:", true},
+		{"pattern:  ", true},
+		{"commit:123456", true},
+
+		// Unknown prefixes are part of a path glob
+		{"docs:example", false},
+	}
+
+	for _, tt := range tests {
+		_, err := parseAllowlist(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAllowlist(%q) error = %v, want error %v", tt.data, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAllowlistSuppress(t *testing.T) {
+	secret := "fixture_aaaaaaaa"
+	match := SecretMatch{
+		CommitHash:  "0123456789abcdef0123456789abcdef01234567",
+		PatternName: "Fixture token",
+		RuleID:      "fixture-token",
+		Secret:      secret,
+		FilePath:    "config/prod/settings.yml",
+	}
+
+	tests := []struct {
+		rules string
+		want  string
+	}{
+		{"", ""},
+		{"# " + secretFingerprint(secret), ""},
+
+		// Fingerprints, with or without the sha256: prefix, in any case
+		{"fingerprint:" + secretFingerprint(secret), suppressedFingerprint},
+		{"fingerprint:" + secretFingerprint(secret)[len("sha256:"):], suppressedFingerprint},
+		{"fingerprint:SHA256:" + secretFingerprint(secret)[len("sha256:"):], suppressedFingerprint},
+		{"fingerprint:" + secretFingerprint("fixture_bbbbbbbb"), ""},
+
+		// Patterns by name or rule id
+		{"pattern:Fixture token", suppressedPattern},
+		{"pattern:fixture-token", suppressedPattern},
+		{"pattern:other-token", ""},
+
+		// Full or abbreviated commit hashes
+		{"commit:0123456789abcdef0123456789abcdef01234567", suppressedCommit},
+		{"commit:0123456", suppressedCommit},
+		{"commit:1234567", ""},
+
+		// Path globs
+		{"path:config/prod/settings.yml", suppressedPath},
+		{"settings.yml", suppressedPath},
+		{"*.yml", suppressedPath},
+		{"config/", suppressedPath},
+		{"config/*.yml", ""},
+		{"config/**/*.yml", suppressedPath},
+		{"/prod/settings.yml", ""},
+		{"**/prod", suppressedPath},
+		{"settings.y?l", suppressedPath},
+		{"*.json", ""},
+
+		// Fingerprints are checked before anything else
+		{"path:config/\nfingerprint:" + secretFingerprint(secret), suppressedFingerprint},
+	}
+
+	for _, tt := range tests {
+		a, err := parseAllowlist(tt.rules)
+		if err != nil {
+			t.Fatalf("parseAllowlist(%q): %v", tt.rules, err)
+		}
+		if got := a.suppress(match); got != tt.want {
+			t.Errorf("suppress with %q = %q, want %q", tt.rules, got, tt.want)
+		}
+	}
+
+	// A nil allowlist suppresses nothing
+	var none *allowlist
+	if got := none.suppress(match); got != "" {
+		t.Errorf("nil allowlist suppress = %q, want \"\"", got)
+	}
+}
+
+func TestAllowlistMerge(t *testing.T) {
+	repo, err := parseAllowlist("pattern:fixture-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, err := parseAllowlist("vendor/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := repo.merge(global)
+
+	tests := []struct {
+		match SecretMatch
+		want  string
+	}{
+		{SecretMatch{RuleID: "fixture-token", FilePath: "main.go"}, suppressedPattern},
+		{SecretMatch{RuleID: "other-token", FilePath: "vendor/lib/x.go"}, suppressedPath},
+		{SecretMatch{RuleID: "other-token", FilePath: "main.go"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := merged.suppress(tt.match); got != tt.want {
+			t.Errorf("merged suppress(%+v) = %q, want %q", tt.match, got, tt.want)
+		}
+	}
+}
+
+func TestScanDiffForSecretsInlineAllow(t *testing.T) {
+	rules := fixtureRules()
+
+	tests := []struct {
+		text string
+		want []string // Suppressed reason of each hit, in order
+	}{
+		{"token = fixture_aaaaaaaa", []string{""}},
+		{"token = fixture_aaaaaaaa # secretsanta:allow", []string{suppressedInline}},
+		{"// secretsanta:allow\ntoken = fixture_aaaaaaaa", []string{""}},
+		{"a = fixture_aaaaaaaa # secretsanta:allow\nb = fixture_bbbbbbbb", []string{suppressedInline, ""}},
+	}
+
+	for _, tt := range tests {
+		hits := scanDiffForSecrets(tt.text, rules)
+		var got []string
+		for _, hit := range hits {
+			got = append(got, hit.Suppressed)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("scanDiffForSecrets(%q) found %d hits, want %d", tt.text, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("scanDiffForSecrets(%q) hit %d suppressed = %q, want %q", tt.text, i+1, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// baselineSchemaVersion is bumped whenever the baseline file layout changes
+const baselineSchemaVersion = 1
+
+// suppressedBaseline marks findings that are already in the baseline
+const suppressedBaseline = "baseline"
+
+// BaselineEntry identifies an accepted finding: a SecretIdentifier within a
+// repository. The secret itself is stored as its fingerprint only.
+type BaselineEntry struct {
+	Repository  string `json:"repository"`
+	FilePath    string `json:"file"`
+	PatternName string `json:"pattern"`
+	Fingerprint string `json:"fingerprint"`
+	Removed     bool   `json:"removed,omitempty"`
+}
+
+// Baseline is the set of triaged findings that scan --baseline doesn't report again
+type Baseline struct {
+	SchemaVersion int             `json:"schema_version"`
+	Created       time.Time       `json:"created"`
+	Updated       time.Time       `json:"updated"`
+	Entries       []BaselineEntry `json:"entries"`
+
+	index map[BaselineEntry]bool
+}
+
+// baselineEntryFor returns the baseline key of a finding
+func baselineEntryFor(match SecretMatch) BaselineEntry {
+	fingerprint := match.Fingerprint
+	if fingerprint == "" {
+		fingerprint = secretFingerprint(match.Secret)
+	}
+
+	return BaselineEntry{
+		Repository:  match.RepoURL,
+		FilePath:    match.FilePath,
+		PatternName: match.PatternName,
+		Fingerprint: fingerprint,
+		Removed:     match.Removed,
+	}
+}
+
+// loadBaseline reads a baseline file
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("error unmarshaling baseline: %v", err)
+	}
+
+	if b.SchemaVersion != baselineSchemaVersion {
+		return nil, fmt.Errorf("baseline %s has schema version %d, expected %d", path, b.SchemaVersion, baselineSchemaVersion)
+	}
+
+	b.reindex()
+	return &b, nil
+}
+
+// saveBaseline writes a baseline file with entries in a stable order
+func saveBaseline(path string, b *Baseline) error {
+	sort.Slice(b.Entries, func(i, j int) bool {
+		x, y := b.Entries[i], b.Entries[j]
+		if x.Repository != y.Repository {
+			return x.Repository < y.Repository
+		}
+		if x.FilePath != y.FilePath {
+			return x.FilePath < y.FilePath
+		}
+		if x.PatternName != y.PatternName {
+			return x.PatternName < y.PatternName
+		}
+		return x.Fingerprint < y.Fingerprint
+	})
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// reindex rebuilds the lookup index from the entries
+func (b *Baseline) reindex() {
+	b.index = make(map[BaselineEntry]bool, len(b.Entries))
+	for _, entry := range b.Entries {
+		b.index[entry] = true
+	}
+}
+
+// contains reports whether a finding is already in the baseline
+func (b *Baseline) contains(match SecretMatch) bool {
+	if b == nil {
+		return false
+	}
+	return b.index[baselineEntryFor(match)]
+}
+
+// add records findings that aren't in the baseline yet and returns how many were added
+func (b *Baseline) add(findings []SecretMatch) int {
+	if b.index == nil {
+		b.reindex()
+	}
+
+	added := 0
+	for _, match := range findings {
+		entry := baselineEntryFor(match)
+		if b.index[entry] {
+			continue
+		}
+		b.index[entry] = true
+		b.Entries = append(b.Entries, entry)
+		added++
+	}
+	return added
+}
+
+var baselineFrom []string
+
+var baselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "Manage the baseline of already triaged findings",
+	Long: `A baseline records findings the team has already triaged, keyed on the
+repository, file, pattern and secret fingerprint. "scan --baseline <file>"
+then only reports findings that aren't in it; baselined findings are counted
+as suppressed.
+
+Findings are read from the findings files of the configured --org and --user
+targets, or from --from files written with "--format json".`,
+}
+
+var baselineCreateCmd = &cobra.Command{
+	Use:   "create <file>",
+	Short: "Snapshot the current findings into a new baseline",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		if _, err := os.Stat(path); err == nil {
+			log.Fatalf("%s already exists, use baseline update to add findings to it", path)
+		}
+
+		findings, err := baselineFindings()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		now := time.Now()
+		b := &Baseline{SchemaVersion: baselineSchemaVersion, Created: now, Updated: now, Entries: []BaselineEntry{}}
+		added := b.add(findings)
+
+		if err := saveBaseline(path, b); err != nil {
+			log.Fatalf("Error writing baseline: %v", err)
+		}
+
+		fmt.Printf("Created %s with %d findings\n", path, added)
+	},
+}
+
+var baselineUpdateCmd = &cobra.Command{
+	Use:   "update <file>",
+	Short: "Add newly triaged findings to an existing baseline",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		b, err := loadBaseline(path)
+		if err != nil {
+			log.Fatalf("Error loading baseline: %v", err)
+		}
+
+		findings, err := baselineFindings()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		added := b.add(findings)
+		b.Updated = time.Now()
+
+		if err := saveBaseline(path, b); err != nil {
+			log.Fatalf("Error writing baseline: %v", err)
+		}
+
+		fmt.Printf("Added %d findings to %s (%d total)\n", added, path, len(b.Entries))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(baselineCmd)
+	baselineCmd.AddCommand(baselineCreateCmd)
+	baselineCmd.AddCommand(baselineUpdateCmd)
+
+	baselineCmd.PersistentFlags().StringSliceVar(&baselineFrom, "from", nil, "JSON findings file to read instead of the targets' findings files (repeatable)")
+}
+
+// baselineFindings loads the findings to put in a baseline, skipping the
+// ones an allowlist suppresses
+func baselineFindings() ([]SecretMatch, error) {
+	var findings []SecretMatch
+
+	if len(baselineFrom) > 0 {
+		for _, path := range baselineFrom {
+			loaded, err := loadFindings(path)
+			if err != nil {
+				return nil, fmt.Errorf("error loading findings from %s: %v", path, err)
+			}
+			findings = append(findings, loaded...)
+		}
+	} else {
+		targets, err := parseTargets(cfg.Orgs, cfg.Users)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, target := range targets {
+			loaded, err := loadFindings(targetFile(cfg.FindingsFile, target))
+			if err != nil {
+				return nil, fmt.Errorf("error loading findings for %s: %v", target, err)
+			}
+			findings = append(findings, loaded...)
+		}
+	}
+
+	active, _ := splitSuppressed(findings)
+	return active, nil
+}
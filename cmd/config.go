@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigName is the config file looked up in the home directory
+const defaultConfigName = ".secretsanta-cli.yaml"
+
+// Config holds the scanner settings after merging defaults, the config file,
+// environment variables and flags, in increasing order of precedence
+type Config struct {
+	Concurrency   int      `yaml:"concurrency"`
+	ReposDir      string   `yaml:"repos_dir"`
+	StateFile     string   `yaml:"state_file"`
+	OutputFile    string   `yaml:"output_file"`
+	Format        string   `yaml:"format"`
+	Redact        string   `yaml:"redact"`
+	Rules         []string `yaml:"rules"`
+	AllowlistFile string   `yaml:"allowlist_file"`
+	CacheFile     string   `yaml:"cache_file"`
+	FindingsFile  string   `yaml:"findings_file"`
+	Orgs          []string `yaml:"orgs"`
+	Users         []string `yaml:"users"`
+
+	// Deprecated settings, accepted so that older config files still load.
+	// RulesFile is the single rules file now given by rules; ScanInterval is
+	// no longer used, repositories new to the scan state get a full-history
+	// scan.
+	RulesFile    string `yaml:"rules_file,omitempty"`
+	ScanInterval string `yaml:"scan_interval,omitempty"`
+}
+
+// setting describes one configurable value and where it can be overridden
+type setting struct {
+	key   string // key in the config file
+	env   string // environment variable
+	flag  string // persistent flag on the root command
+	usage string
+	field func(c *Config) interface{} // pointer to the value inside a Config
+}
+
+var settings = []setting{
+	{"concurrency", "SECRETSANTA_CONCURRENCY", "concurrency", "number of repositories cloned or scanned concurrently",
+		func(c *Config) interface{} { return &c.Concurrency }},
+	{"repos_dir", "SECRETSANTA_REPOS_DIR", "repos-dir", "directory that holds cloned repositories",
+		func(c *Config) interface{} { return &c.ReposDir }},
+	{"state_file", "SECRETSANTA_STATE_FILE", "state-file", "file that tracks the last scan of each repository",
+		func(c *Config) interface{} { return &c.StateFile }},
+	{"output_file", "SECRETSANTA_OUTPUT_FILE", "output", "report file to write findings to",
+		func(c *Config) interface{} { return &c.OutputFile }},
+	{"format", "SECRETSANTA_FORMAT", "format", "output format: markdown, json, jsonl, sarif or csv",
+		func(c *Config) interface{} { return &c.Format }},
+	{"redact", "SECRETSANTA_REDACT", "redact", "how secret values are redacted in reports: full, partial or hash",
+		func(c *Config) interface{} { return &c.Redact }},
+	{"rules", "SECRETSANTA_RULES", "rules", "rules file or directory of rules files, or \"default\" for the built-in rules (repeatable)",
+		func(c *Config) interface{} { return &c.Rules }},
+	{"allowlist_file", "SECRETSANTA_ALLOWLIST_FILE", "allowlist", "global allowlist file applied to every repository",
+		func(c *Config) interface{} { return &c.AllowlistFile }},
+	{"cache_file", "SECRETSANTA_CACHE_FILE", "cache", "repository cache written by fetch-repos",
+		func(c *Config) interface{} { return &c.CacheFile }},
+	{"findings_file", "SECRETSANTA_FINDINGS_FILE", "findings", "file that accumulates findings across runs",
+		func(c *Config) interface{} { return &c.FindingsFile }},
+	{"orgs", "SECRETSANTA_ORGS", "org", "GitHub organization to scan (repeatable)",
+		func(c *Config) interface{} { return &c.Orgs }},
+	{"users", "SECRETSANTA_USERS", "user", "GitHub user account to scan (repeatable)",
+		func(c *Config) interface{} { return &c.Users }},
+}
+
+var (
+	cfgFile string
+	cfg     *Config
+
+	// flagCfg receives the raw flag values; only flags that were set are applied
+	flagCfg = defaultConfig()
+)
+
+// defaultConfig returns the built-in settings
+func defaultConfig() *Config {
+	return &Config{
+		Concurrency:  scanConcurrency,
+		ReposDir:     reposDir,
+		StateFile:    stateFile,
+		OutputFile:   outputFile,
+		Format:       formatMarkdown,
+		Redact:       redactPartial,
+		CacheFile:    reposCache,
+		FindingsFile: findingsFile,
+	}
+}
+
+// defaultConfigPath returns $HOME/.secretsanta-cli.yaml
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, defaultConfigName)
+}
+
+// configPath returns the config file to load and whether it was asked for explicitly
+func configPath() (string, bool) {
+	if cfgFile != "" {
+		return cfgFile, true
+	}
+	if path := os.Getenv("SECRETSANTA_CONFIG"); path != "" {
+		return path, true
+	}
+	return defaultConfigPath(), false
+}
+
+// loadConfig resolves the settings for this invocation. Precedence, from
+// lowest to highest: defaults, config file, environment variables, flags.
+func loadConfig(cmd *cobra.Command) (*Config, error) {
+	c := defaultConfig()
+
+	path, explicit := configPath()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) || explicit {
+				return nil, fmt.Errorf("reading config file: %v", err)
+			}
+		} else if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+		}
+
+		if c.RulesFile != "" {
+			log.Printf("Warning: %s sets rules_file, which is deprecated: use rules", path)
+			if len(c.Rules) == 0 {
+				c.Rules = []string{c.RulesFile}
+			}
+			c.RulesFile = ""
+		}
+		if c.ScanInterval != "" {
+			log.Printf("Warning: %s sets scan_interval, which is ignored: repositories new to the scan state get a full-history scan", path)
+			c.ScanInterval = ""
+		}
+	}
+
+	// SECRETSANTA_RULES_FILE is the deprecated name of SECRETSANTA_RULES,
+	// which takes precedence when both are set
+	if value := os.Getenv("SECRETSANTA_RULES_FILE"); value != "" {
+		log.Printf("Warning: SECRETSANTA_RULES_FILE is deprecated: use SECRETSANTA_RULES")
+		c.Rules = []string{value}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := setFromString(s.field(c), value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if cmd.Flags().Changed(s.flag) {
+			copySetting(s.field(c), s.field(flagCfg))
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// validate checks the resolved settings
+func (c *Config) validate() error {
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if !contains(outputFormats, c.Format) {
+		return fmt.Errorf("invalid format %q, must be one of %s", c.Format, strings.Join(outputFormats, ", "))
+	}
+	if !contains(redactionModes, c.Redact) {
+		return fmt.Errorf("invalid redact mode %q, must be one of %s", c.Redact, strings.Join(redactionModes, ", "))
+	}
+	return nil
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// setFromString parses an environment variable into a setting
+func setFromString(field interface{}, value string) error {
+	switch f := field.(type) {
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*f = n
+	case *string:
+		*f = value
+	case *[]string:
+		*f = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*f = append(*f, v)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// copySetting copies a setting value between two configs
+func copySetting(dst, src interface{}) {
+	switch d := dst.(type) {
+	case *int:
+		*d = *src.(*int)
+	case *string:
+		*d = *src.(*string)
+	case *[]string:
+		*d = append([]string(nil), *src.(*[]string)...)
+	}
+}
+
+// addSettingFlags registers a persistent flag for every setting
+func addSettingFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	for _, s := range settings {
+		switch f := s.field(flagCfg).(type) {
+		case *int:
+			flags.IntVar(f, s.flag, *f, s.usage)
+		case *string:
+			flags.StringVar(f, s.flag, *f, s.usage)
+		case *[]string:
+			flags.StringSliceVar(f, s.flag, *f, s.usage)
+		}
+	}
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the resolved configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the settings after applying the config file, environment and flags",
+	Long: `Show prints every setting as it will be used, after merging (from lowest to
+highest precedence) the built-in defaults, the config file, SECRETSANTA_*
+environment variables and command line flags. The output is valid config
+file YAML.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+
+		path, _ := configPath()
+		if _, err := os.Stat(path); err != nil {
+			fmt.Printf("# config file: %s (not found)\n", path)
+		} else {
+			fmt.Printf("# config file: %s\n", path)
+		}
+
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
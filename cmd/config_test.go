@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoadConfigDeprecatedRules(t *testing.T) {
+	tests := []struct {
+		file string            // Config file contents
+		env  map[string]string // SECRETSANTA_RULES and SECRETSANTA_RULES_FILE, unset if missing
+		want []string
+	}{
+		{"", nil, nil},
+
+		// The rules_file key and SECRETSANTA_RULES_FILE still work
+		{"rules_file: old.yml\n", nil, []string{"old.yml"}},
+		{"", map[string]string{"SECRETSANTA_RULES_FILE": "env.yml"}, []string{"env.yml"}},
+
+		// The current names win at the same level; the environment wins over the file
+		{"rules: [new.yml]\nrules_file: old.yml\n", nil, []string{"new.yml"}},
+		{"", map[string]string{"SECRETSANTA_RULES": "a.yml,b.yml", "SECRETSANTA_RULES_FILE": "env.yml"}, []string{"a.yml", "b.yml"}},
+		{"rules: [new.yml]\n", map[string]string{"SECRETSANTA_RULES_FILE": "env.yml"}, []string{"env.yml"}},
+		{"rules_file: old.yml\n", map[string]string{"SECRETSANTA_RULES_FILE": "env.yml"}, []string{"env.yml"}},
+
+		// An empty variable is ignored, like an unset one
+		{"rules: [new.yml]\n", map[string]string{"SECRETSANTA_RULES_FILE": ""}, []string{"new.yml"}},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SECRETSANTA_CONFIG", path)
+
+		for _, name := range []string{"SECRETSANTA_RULES", "SECRETSANTA_RULES_FILE"} {
+			t.Setenv(name, "")
+			if value, ok := tt.env[name]; ok {
+				os.Setenv(name, value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+
+		cmd := &cobra.Command{}
+		addSettingFlags(cmd)
+		c, err := loadConfig(cmd)
+		if err != nil {
+			t.Errorf("loadConfig with %q and %v: %v", tt.file, tt.env, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Rules, tt.want) {
+			t.Errorf("loadConfig with %q and %v: rules = %q, want %q", tt.file, tt.env, c.Rules, tt.want)
+		}
+		if c.RulesFile != "" {
+			t.Errorf("loadConfig with %q and %v: rules_file = %q, want it cleared", tt.file, tt.env, c.RulesFile)
+		}
+	}
+}
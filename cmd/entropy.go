@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Character sets the entropy detector distinguishes
+const (
+	charsetHex    = "hex"
+	charsetBase64 = "base64"
+)
+
+// defaultEntropyThresholds are the minimum Shannon entropies, in bits per
+// character, for a token of each charset to be reported
+var defaultEntropyThresholds = map[string]float64{
+	charsetHex:    3.0,
+	charsetBase64: 4.0,
+}
+
+// entropyMinLength is the shortest token the entropy detector considers
+const entropyMinLength = 16
+
+// entropyAssignment matches a value assigned to a keyword-like identifier,
+// e.g. API_KEY = "..." or "client_secret": "...". The value is group 2.
+var entropyAssignment = regexp.MustCompile(
+	`(?i)([a-z0-9_.-]*(?:key|secret|token|passw(?:or)?d|pwd|credential|auth)[a-z0-9_.-]*)["']?\s*(?::=|=>|[:=])\s*["'\x60]?([A-Za-z0-9+/=_-]{16,})`)
+
+var hexToken = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// entropyRules are the rules entropy hits are reported under, by charset
+var entropyRules = map[string]*rule{
+	charsetHex:    entropyRule(charsetHex),
+	charsetBase64: entropyRule(charsetBase64),
+}
+
+// entropyRule describes the entropy detector's findings for one charset
+func entropyRule(charset string) *rule {
+	return &rule{YamlPattern: YamlPattern{
+		ID:          "high-entropy-" + charset,
+		Name:        fmt.Sprintf("High Entropy String (%s)", charset),
+		Confidence:  "low",
+		Description: fmt.Sprintf("A random-looking %s value assigned to a key, secret, token or password identifier.", charset),
+		Severity:    "medium",
+		Tags:        []string{"generic", "entropy"},
+		Remediation: "Check whether the value is a credential. If it is, rotate it and load it from the environment or a secret manager instead.",
+	}}
+}
+
+// entropyDetector finds high-entropy base64 and hex tokens assigned to
+// keyword-like identifiers. It runs next to the regex rules.
+type entropyDetector struct {
+	thresholds map[string]float64
+}
+
+// newEntropyDetector returns a detector with the default thresholds,
+// overridden per charset by thresholds
+func newEntropyDetector(thresholds map[string]string) (*entropyDetector, error) {
+	d := &entropyDetector{thresholds: make(map[string]float64)}
+	for charset, threshold := range defaultEntropyThresholds {
+		d.thresholds[charset] = threshold
+	}
+
+	for charset, value := range thresholds {
+		if _, ok := defaultEntropyThresholds[charset]; !ok {
+			return nil, fmt.Errorf("unknown entropy charset %q, must be %s or %s", charset, charsetHex, charsetBase64)
+		}
+
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("invalid entropy threshold %q for %s", value, charset)
+		}
+		d.thresholds[charset] = threshold
+	}
+
+	return d, nil
+}
+
+// scanLine returns hits for high-entropy values on a single line
+func (d *entropyDetector) scanLine(line string) []secretHit {
+	var hits []secretHit
+
+	for _, loc := range entropyAssignment.FindAllStringSubmatchIndex(line, -1) {
+		token := strings.TrimRight(line[loc[4]:loc[5]], "=")
+		if len(token) < entropyMinLength {
+			continue
+		}
+
+		charset := charsetBase64
+		if hexToken.MatchString(token) {
+			charset = charsetHex
+		}
+
+		entropy := shannonEntropy(token)
+		if entropy < d.thresholds[charset] {
+			continue
+		}
+
+		hits = append(hits, secretHit{
+			Secret:  token,
+			Rule:    entropyRules[charset],
+			Column:  loc[4] + 1,
+			Entropy: math.Round(entropy*100) / 100,
+		})
+	}
+
+	return hits
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var entropy float64
+	length := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"abab", 1},
+		{"abcd", 2},
+		{"0123456789abcdef", 4},
+	}
+
+	for _, tt := range tests {
+		if got := shannonEntropy(tt.s); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("shannonEntropy(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestNewEntropyDetector(t *testing.T) {
+	tests := []struct {
+		thresholds map[string]string
+		want       map[string]float64
+		wantErr    bool
+	}{
+		{nil, map[string]float64{charsetHex: 3.0, charsetBase64: 4.0}, false},
+		{map[string]string{charsetHex: "3.5"}, map[string]float64{charsetHex: 3.5, charsetBase64: 4.0}, false},
+		{map[string]string{charsetBase64: "4.25"}, map[string]float64{charsetHex: 3.0, charsetBase64: 4.25}, false},
+		{map[string]string{"ascii": "4"}, nil, true},
+		{map[string]string{charsetHex: "high"}, nil, true},
+		{map[string]string{charsetHex: "0"}, nil, true},
+		{map[string]string{charsetBase64: "-1"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		d, err := newEntropyDetector(tt.thresholds)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newEntropyDetector(%v) error = %v, want error %v", tt.thresholds, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(d.thresholds, tt.want) {
+			t.Errorf("newEntropyDetector(%v) thresholds = %v, want %v", tt.thresholds, d.thresholds, tt.want)
+		}
+	}
+
+	// Defaults are copied, not shared
+	d, _ := newEntropyDetector(map[string]string{charsetHex: "1"})
+	if defaultEntropyThresholds[charsetHex] != 3.0 || d.thresholds[charsetHex] != 1 {
+		t.Errorf("overriding a threshold changed the defaults: %v", defaultEntropyThresholds)
+	}
+}
+
+func TestEntropyScanLine(t *testing.T) {
+	d, err := newEntropyDetector(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type hit struct {
+		Secret string
+		RuleID string
+		Column int
+	}
+
+	tests := []struct {
+		line string
+		want []hit
+	}{
+		// Random values assigned to keyword-like identifiers
+		{`API_KEY = "3f9a1c7e5b2d8046af1e9c3b7d5a2e80"`,
+			[]hit{{"3f9a1c7e5b2d8046af1e9c3b7d5a2e80", "high-entropy-hex", 12}}},
+		{`aws_secret_access_key: wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY`,
+			[]hit{{"wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "high-entropy-base64", 24}}},
+		{`"client_secret": "Zm9vYmFyYmF6cXV4MTIzNDU2Nzg5MGFiY2RlZg=="`,
+			[]hit{{"Zm9vYmFyYmF6cXV4MTIzNDU2Nzg5MGFiY2RlZg", "high-entropy-base64", 19}}},
+		{`token := "3f9a1c7e5b2d8046af1e9c3b7d5a2e80"; password => "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"`,
+			[]hit{
+				{"3f9a1c7e5b2d8046af1e9c3b7d5a2e80", "high-entropy-hex", 11},
+				{"wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "high-entropy-base64", 59},
+			}},
+
+		// Below the charset's threshold
+		{`API_KEY = "0000111122223333"`, nil},
+		{`secret = "aaaaaaaaaaaaaaaaaaaaaaaa"`, nil},
+		{`secret = "passwordpasswordpassword"`, nil},
+
+		// Too short, once base64 padding is trimmed
+		{`token = "3f9a1c7e5b2d804"`, nil},
+		{`token = "Zm9vYmFyYmF6cXV4==="`, nil},
+
+		// No keyword-like identifier
+		{`checksum = "3f9a1c7e5b2d8046af1e9c3b7d5a2e80"`, nil},
+		{`"3f9a1c7e5b2d8046af1e9c3b7d5a2e80"`, nil},
+	}
+
+	for _, tt := range tests {
+		var got []hit
+		for _, h := range d.scanLine(tt.line) {
+			got = append(got, hit{h.Secret, h.Rule.ID, h.Column})
+			if h.Entropy <= 0 {
+				t.Errorf("scanLine(%q) hit %q has no entropy", tt.line, h.Secret)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scanLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
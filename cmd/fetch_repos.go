@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"log"
+	"secretsanta-cli/local"
+
+	"github.com/spf13/cobra"
+)
+
+var fetchReposCmd = &cobra.Command{
+	Use:   "fetch-repos",
+	Short: "Fetch repositories of organizations and users from GitHub and cache them",
+	Long: `Fetch-repos lists every repository of each --org and --user target through
+the GitHub API and stores the result in that target's repository cache used
+by scan. GITHUB_TOKEN must be set in the environment or in a .env file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := parseTargets(cfg.Orgs, cfg.Users)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		local.FetchAndCacheRepos(targets, func(target local.Target) string {
+			return targetFile(cfg.CacheFile, target)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fetchReposCmd)
+}
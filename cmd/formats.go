@@ -0,0 +1,443 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// findingsSchemaVersion is bumped when the JSON layout of SecretMatch changes
+// in a way older readers can't handle, such as a renamed, removed or retyped
+// field. New optional fields don't change it: readers ignore unknown fields,
+// and findings files of older versions still load.
+const findingsSchemaVersion = 1
+
+// Output formats for findings
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatJSONL    = "jsonl"
+	formatSARIF    = "sarif"
+	formatCSV      = "csv"
+)
+
+var outputFormats = []string{formatMarkdown, formatJSON, formatJSONL, formatSARIF, formatCSV}
+
+// FindingsDocument is the top-level JSON document holding findings, used for
+// both the findings file and the json output format
+type FindingsDocument struct {
+	SchemaVersion int            `json:"schema_version"`
+	Findings      []SecretMatch  `json:"findings"`
+	Suppressed    map[string]int `json:"suppressed,omitempty"` // Suppressed findings by reason, json output only
+}
+
+// findingLine is a single finding as written in the jsonl output format
+type findingLine struct {
+	SchemaVersion int `json:"schema_version"`
+	SecretMatch
+}
+
+// summaryLine follows the findings of a run in the jsonl output format when
+// the allowlists suppressed some of them
+type summaryLine struct {
+	SchemaVersion int        `json:"schema_version"`
+	Summary       runSummary `json:"summary"`
+}
+
+// runSummary counts the findings of a run that aren't written as lines
+type runSummary struct {
+	Suppressed map[string]int `json:"suppressed"` // Suppressed findings by reason
+}
+
+// writeScanOutput writes the findings of one scan run to outputFile. Markdown
+// and JSONL are appended to, so the file accumulates runs; the other formats
+// are rewritten with this run's findings only. Suppressed findings are only
+// counted, except in SARIF and CSV which record them as suppressed results.
+func writeScanOutput(format, outputFile string, findings []SecretMatch) error {
+	findings = redactFindings(findings, redactionMode())
+	active, suppressed := splitSuppressed(findings)
+
+	switch format {
+	case formatMarkdown:
+		return appendToReport(outputFile, active, suppressed)
+	case formatJSONL:
+		f, err := openPrivate(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return writeJSONL(f, active, suppressed)
+	default:
+		return writeOutputFile(format, outputFile, findings)
+	}
+}
+
+// writeOutput writes a fresh output file in the given format
+func writeOutput(format, outputFile string, findings []SecretMatch) error {
+	findings = redactFindings(findings, redactionMode())
+
+	if format == formatMarkdown {
+		active, suppressed := splitSuppressed(findings)
+		return writeReport(outputFile, active, suppressed)
+	}
+
+	return writeOutputFile(format, outputFile, findings)
+}
+
+// writeOutputFile writes already redacted findings in one of the structured formats
+func writeOutputFile(format, outputFile string, findings []SecretMatch) error {
+	f, err := openPrivate(outputFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	active, suppressed := splitSuppressed(findings)
+
+	switch format {
+	case formatJSON:
+		return writeJSON(f, active, suppressed)
+	case formatJSONL:
+		return writeJSONL(f, active, suppressed)
+	case formatSARIF:
+		return writeSARIF(f, findings)
+	case formatCSV:
+		return writeCSV(f, findings)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeJSON writes findings as a single FindingsDocument
+func writeJSON(w io.Writer, findings, suppressed []SecretMatch) error {
+	if findings == nil {
+		findings = []SecretMatch{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(FindingsDocument{
+		SchemaVersion: findingsSchemaVersion,
+		Findings:      findings,
+		Suppressed:    suppressedCounts(suppressed),
+	})
+}
+
+// writeJSONL writes one JSON object per finding and line, followed by a
+// summary line counting the suppressed findings if there are any
+func writeJSONL(w io.Writer, findings, suppressed []SecretMatch) error {
+	enc := json.NewEncoder(w)
+	for _, match := range findings {
+		if err := enc.Encode(findingLine{SchemaVersion: findingsSchemaVersion, SecretMatch: match}); err != nil {
+			return err
+		}
+	}
+
+	if len(suppressed) == 0 {
+		return nil
+	}
+	return enc.Encode(summaryLine{
+		SchemaVersion: findingsSchemaVersion,
+		Summary:       runSummary{Suppressed: suppressedCounts(suppressed)},
+	})
+}
+
+// csvHeader lists the columns written by writeCSV
+var csvHeader = []string{
+	"repository", "commit", "file", "line", "end_line", "column", "pattern", "confidence",
+	"rule_id", "severity", "tags", "description", "remediation", "references",
+	"removed", "author", "author_email", "date", "secret", "fingerprint", "entropy", "verified",
+	"refs", "head_status", "suppressed",
+}
+
+// writeCSV writes findings as comma-separated values with a header row.
+// Suppressed findings are included with the reason in the suppressed column.
+func writeCSV(w io.Writer, findings []SecretMatch) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, match := range findings {
+		err := cw.Write([]string{
+			match.RepoURL,
+			match.CommitHash,
+			match.FilePath,
+			strconv.Itoa(match.Line),
+			strconv.Itoa(max(match.EndLine, match.Line)),
+			strconv.Itoa(match.Column),
+			match.PatternName,
+			match.Confidence,
+			match.RuleID,
+			match.Severity,
+			strings.Join(match.Tags, ";"),
+			match.Description,
+			match.Remediation,
+			strings.Join(match.References, " "),
+			strconv.FormatBool(match.Removed),
+			match.Author,
+			match.AuthorEmail,
+			match.Date.Format("2006-01-02T15:04:05Z07:00"),
+			match.Secret,
+			match.Fingerprint,
+			entropyField(match.Entropy),
+			match.Verified,
+			strings.Join(match.Refs, " "),
+			match.HeadStatus,
+			match.Suppressed,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// entropyField formats an entropy score for CSV, empty for regex findings
+func entropyField(entropy float64) string {
+	if entropy == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(entropy, 'f', 2, 64)
+}
+
+// SARIF 2.1.0 structures, limited to the properties secretsanta-cli fills in
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool                     sarifTool             `json:"tool"`
+	VersionControlProvenance []sarifVersionControl `json:"versionControlProvenance,omitempty"`
+	Results                  []sarifResult         `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	FullDescription  *sarifMessage          `json:"fullDescription,omitempty"`
+	Help             *sarifMessage          `json:"help,omitempty"`
+	HelpURI          string                 `json:"helpUri,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifVersionControl struct {
+	RepositoryURI string `json:"repositoryUri"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Suppressions        []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	EndLine     int `json:"endLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// writeSARIF writes findings as a SARIF 2.1.0 log with one run per repository
+func writeSARIF(w io.Writer, findings []SecretMatch) error {
+	repoFindings := make(map[string][]SecretMatch)
+	var repoURLs []string
+	for _, match := range findings {
+		if _, ok := repoFindings[match.RepoURL]; !ok {
+			repoURLs = append(repoURLs, match.RepoURL)
+		}
+		repoFindings[match.RepoURL] = append(repoFindings[match.RepoURL], match)
+	}
+	sort.Strings(repoURLs)
+
+	doc := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{},
+	}
+
+	for _, repoURL := range repoURLs {
+		repoRun := sarifRun{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "secretsanta-cli",
+				InformationURI: "https://github.com/KatrixReloaded/secretsanta-cli",
+				Rules:          []sarifRule{},
+			}},
+			VersionControlProvenance: []sarifVersionControl{{RepositoryURI: repoURL}},
+			Results:                  []sarifResult{},
+		}
+
+		ruleIndex := make(map[string]int)
+		for _, match := range repoFindings[repoURL] {
+			// Findings saved before rules had ids fall back to the name
+			id := match.RuleID
+			if id == "" {
+				id = ruleID(match.PatternName)
+			}
+
+			index, ok := ruleIndex[id]
+			if !ok {
+				index = len(repoRun.Tool.Driver.Rules)
+				ruleIndex[id] = index
+				repoRun.Tool.Driver.Rules = append(repoRun.Tool.Driver.Rules, sarifRuleFor(id, match))
+			}
+
+			message := fmt.Sprintf("%s found in commit %s", match.PatternName, match.CommitHash)
+			if match.Removed {
+				message = fmt.Sprintf("%s removed in commit %s", match.PatternName, match.CommitHash)
+			}
+
+			var suppressions []sarifSuppression
+			switch match.Suppressed {
+			case "":
+			case suppressedInline:
+				suppressions = append(suppressions, sarifSuppression{Kind: "inSource", Justification: inlineAllowMarker})
+			case suppressedBaseline:
+				suppressions = append(suppressions, sarifSuppression{Kind: "external", Justification: "already triaged in the baseline"})
+			default:
+				suppressions = append(suppressions, sarifSuppression{Kind: "external", Justification: "allowlist " + match.Suppressed + " rule"})
+			}
+
+			repoRun.Results = append(repoRun.Results, sarifResult{
+				RuleID:    id,
+				RuleIndex: index,
+				Level:     sarifLevel(match.Confidence),
+				Message:   sarifMessage{Text: message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: match.FilePath},
+					Region: sarifRegion{
+						StartLine:   max(match.Line, 1),
+						EndLine:     match.EndLine,
+						StartColumn: match.Column,
+						EndColumn:   match.EndColumn,
+					},
+				}}},
+				PartialFingerprints: map[string]string{
+					// v1 left out the secret, which merged the alerts of
+					// different secrets in the same file and commit
+					"secretsanta/v2": strings.Join([]string{id, match.FilePath, match.CommitHash,
+						strconv.Itoa(match.Line), strconv.Itoa(match.Column), findingFingerprint(match)}, ":"),
+				},
+				Suppressions: suppressions,
+				Properties: map[string]interface{}{
+					"commit":   match.CommitHash,
+					"author":   match.AuthorEmail,
+					"removed":  match.Removed,
+					"entropy":  match.Entropy,
+					"verified": match.Verified,
+					"refs":     match.Refs,
+					"head":     match.HeadStatus,
+				},
+			})
+		}
+
+		doc.Runs = append(doc.Runs, repoRun)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// sarifRuleFor describes the rule of a finding, with the metadata the finding carries
+func sarifRuleFor(id string, match SecretMatch) sarifRule {
+	r := sarifRule{
+		ID:               id,
+		Name:             match.PatternName,
+		ShortDescription: sarifMessage{Text: match.PatternName},
+		Properties:       map[string]interface{}{"confidence": match.Confidence},
+	}
+
+	if match.Description != "" {
+		r.FullDescription = &sarifMessage{Text: match.Description}
+	}
+	if match.Remediation != "" {
+		r.Help = &sarifMessage{Text: match.Remediation}
+	}
+	if len(match.References) > 0 {
+		r.HelpURI = match.References[0]
+	}
+	if len(match.Tags) > 0 {
+		r.Properties["tags"] = match.Tags
+	}
+	if score, ok := securitySeverity[match.Severity]; ok {
+		r.Properties["severity"] = match.Severity
+		r.Properties["security-severity"] = score
+	}
+
+	return r
+}
+
+// securitySeverity maps rule severities to the CVSS-like scores GitHub code
+// scanning reads from the security-severity property
+var securitySeverity = map[string]string{
+	"low":      "3.0",
+	"medium":   "5.5",
+	"high":     "8.0",
+	"critical": "9.5",
+}
+
+// sarifLevel maps rule confidence to a SARIF result level
+func sarifLevel(confidence string) string {
+	if confidenceLevels[confidence] >= confidenceLevels["high"] {
+		return "error"
+	}
+	return "warning"
+}
+
+var nonIDChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ruleID derives a rule identifier from a pattern name,
+// e.g. "Github Personal Access Token" -> "github-personal-access-token"
+func ruleID(name string) string {
+	return strings.Trim(nonIDChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// zeroSHA is the object name git uses for a ref that doesn't exist
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// hookFinding is a secret found in a staged or pushed change
+type hookFinding struct {
+	Commit      string
+	FilePath    string
+	Line        int
+	Column      int
+	PatternName string
+	RuleID      string
+	Secret      string
+}
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Run as a git hook and block commits or pushes that add secrets",
+	Long: `Hook scans the changes git is about to record or send, using only the
+high-confidence rules. If any of them matches an added
+line the hook prints the findings and exits non-zero, which makes git abort.
+The repository's .secretsantaignore, the global allowlist and inline
+"secretsanta:allow" comments are honored.
+
+Use "secretsanta-cli install-hook" to set it up in a repository.`,
+}
+
+var hookPreCommitCmd = &cobra.Command{
+	Use:   "pre-commit",
+	Short: "Scan the staged changes of the current repository",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		rules, err := loadPatterns(cfg.Rules, ruleSelection{MinConfidence: "high"})
+		if err != nil {
+			log.Fatalf("Error loading patterns: %v", err)
+		}
+
+		diff, err := gitOutput("diff", "--cached", "--no-color", "--no-ext-diff", "-U0")
+		if err != nil {
+			log.Fatalf("Error reading staged changes: %v", err)
+		}
+
+		findings := scanUnifiedDiff(diff, rules)
+		exitOnHookFindings(filterHookFindings(findings), "commit")
+	},
+}
+
+var hookPrePushCmd = &cobra.Command{
+	Use:   "pre-push [remote] [url]",
+	Short: "Scan the commits being pushed, as listed by git on stdin",
+	Args:  cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		rules, err := loadPatterns(cfg.Rules, ruleSelection{MinConfidence: "high"})
+		if err != nil {
+			log.Fatalf("Error loading patterns: %v", err)
+		}
+
+		var findings []hookFinding
+
+		// Each line is "<local ref> <local sha> <remote ref> <remote sha>"
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 4 {
+				continue
+			}
+
+			localSHA, remoteSHA := fields[1], fields[3]
+			if localSHA == zeroSHA {
+				// Deleting a remote ref pushes no commits
+				continue
+			}
+
+			// New remote refs only push commits no other remote ref has. So
+			// do force pushes over a remote commit this repository never
+			// fetched, which git log can't exclude.
+			revs := []string{remoteSHA + ".." + localSHA}
+			if remoteSHA == zeroSHA || !gitHasObject(remoteSHA) {
+				revs = []string{localSHA, "--not", "--remotes"}
+			}
+
+			logArgs := append([]string{"log", "-p", "--no-color", "--no-ext-diff", "-U0", "--format=%x00%H"}, revs...)
+			diff, err := gitOutput(logArgs...)
+			if err != nil {
+				log.Fatalf("Error reading commits for %s: %v", fields[0], err)
+			}
+
+			findings = append(findings, scanUnifiedDiff(diff, rules)...)
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Error reading refs from stdin: %v", err)
+		}
+
+		exitOnHookFindings(filterHookFindings(findings), "push")
+	},
+}
+
+var (
+	installHookBinary string
+	installHookForce  bool
+)
+
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook [pre-commit|pre-push]...",
+	Short: "Install the secret scanning git hook in the current repository",
+	Long: `Install-hook writes git hook scripts that run "secretsanta-cli hook" into the
+hooks directory of the current repository. Without arguments both the
+pre-commit and pre-push hooks are installed. Rules files given with --rules
+are recorded as absolute paths so the hook works from any directory; without
+--rules the hook uses the built-in rules.`,
+	ValidArgs: []string{"pre-commit", "pre-push"},
+	Args:      cobra.OnlyValidArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		hooks := args
+		if len(hooks) == 0 {
+			hooks = []string{"pre-commit", "pre-push"}
+		}
+
+		binary := installHookBinary
+		if binary == "" {
+			exe, err := os.Executable()
+			if err != nil {
+				log.Fatalf("Error locating secretsanta-cli binary, use --binary: %v", err)
+			}
+			binary = exe
+		}
+
+		var rulesArgs string
+		for _, source := range cfg.Rules {
+			if source != defaultRules {
+				abs, err := filepath.Abs(source)
+				if err != nil {
+					log.Fatalf("Error resolving rules file: %v", err)
+				}
+				source = abs
+			}
+			rulesArgs += " --rules " + shellQuote(source)
+		}
+
+		// Respects core.hooksPath and worktrees
+		hooksDir, err := gitOutput("rev-parse", "--git-path", "hooks")
+		if err != nil {
+			log.Fatalf("Error locating hooks directory, is this a git repository? %v", err)
+		}
+		hooksDir = strings.TrimSpace(hooksDir)
+
+		if err := os.MkdirAll(hooksDir, 0755); err != nil {
+			log.Fatalf("Failed to create hooks directory: %v", err)
+		}
+
+		for _, hook := range hooks {
+			path := filepath.Join(hooksDir, hook)
+			if _, err := os.Stat(path); err == nil && !installHookForce {
+				log.Fatalf("%s already exists, use --force to overwrite it", path)
+			}
+
+			script := fmt.Sprintf("#!/bin/sh\n# Installed by secretsanta-cli install-hook\nexec %s hook %s%s \"$@\"\n",
+				shellQuote(binary), hook, rulesArgs)
+			if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+				log.Fatalf("Error writing %s: %v", path, err)
+			}
+
+			fmt.Printf("Installed %s hook at %s\n", hook, path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+	hookCmd.AddCommand(hookPreCommitCmd)
+	hookCmd.AddCommand(hookPrePushCmd)
+
+	rootCmd.AddCommand(installHookCmd)
+	installHookCmd.Flags().StringVar(&installHookBinary, "binary", "", "secretsanta-cli binary the hook runs (default is the running executable)")
+	installHookCmd.Flags().BoolVar(&installHookForce, "force", false, "overwrite existing hooks")
+}
+
+// gitOutput runs git in the current directory and returns its stdout
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+
+	return string(out), nil
+}
+
+// gitHasObject reports whether the repository has the object named by sha
+func gitHasObject(sha string) bool {
+	return exec.Command("git", "cat-file", "-e", sha).Run() == nil
+}
+
+// scanUnifiedDiff looks for secrets in the added lines of a unified diff, as
+// printed by git diff or git log -p. Lines starting with NUL name the commit
+// the following diffs belong to. Consecutive added lines are scanned as one
+// block, with their "+" prefixes stripped, so multi-line rules can match.
+func scanUnifiedDiff(diff string, rules *patternSet) []hookFinding {
+	var findings []hookFinding
+	var commit, filePath string
+	var added []string
+	line, addedStart := 0, 0
+
+	flush := func() {
+		if len(added) == 0 {
+			return
+		}
+
+		for _, hit := range scanDiffForSecrets(strings.Join(added, "\n"), rules) {
+			if hit.Suppressed != "" {
+				continue
+			}
+
+			hit.shift(addedStart - 1)
+			findings = append(findings, hookFinding{
+				Commit:      commit,
+				FilePath:    filePath,
+				Line:        hit.Line,
+				Column:      hit.Column,
+				PatternName: hit.Rule.Name,
+				RuleID:      hit.Rule.ID,
+				Secret:      hit.Secret,
+			})
+		}
+		added = nil
+	}
+
+	for _, text := range strings.Split(diff, "\n") {
+		if !strings.HasPrefix(text, "+") || strings.HasPrefix(text, "+++ ") {
+			flush()
+		}
+
+		switch {
+		case strings.HasPrefix(text, "\x00"):
+			commit = strings.TrimPrefix(text, "\x00")
+		case strings.HasPrefix(text, "+++ "):
+			filePath = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+		case strings.HasPrefix(text, "@@ "):
+			line = hunkNewStart(text)
+		case strings.HasPrefix(text, "+"):
+			if len(added) == 0 {
+				addedStart = line
+			}
+			added = append(added, text[1:])
+			line++
+		case strings.HasPrefix(text, " "):
+			line++
+		}
+	}
+	flush()
+
+	return findings
+}
+
+// filterHookFindings drops findings suppressed by the repository's
+// .secretsantaignore or the global allowlist
+func filterHookFindings(findings []hookFinding) []hookFinding {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	allow, err := loadAllowlistFile(cfg.AllowlistFile)
+	if err != nil {
+		log.Fatalf("Error loading allowlist: %v", err)
+	}
+
+	if root, err := gitOutput("rev-parse", "--show-toplevel"); err == nil {
+		repoAllow, err := loadAllowlistFile(filepath.Join(strings.TrimSpace(root), ignoreFileName))
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", ignoreFileName, err)
+		}
+		allow = allow.merge(repoAllow)
+	}
+
+	var kept []hookFinding
+	for _, f := range findings {
+		match := SecretMatch{
+			CommitHash:  f.Commit,
+			FilePath:    f.FilePath,
+			PatternName: f.PatternName,
+			RuleID:      f.RuleID,
+			Secret:      f.Secret,
+		}
+		if allow.suppress(match) == "" {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// hunkNewStart returns the first line number in the new file of a hunk
+// header such as "@@ -12,3 +14,5 @@"
+func hunkNewStart(header string) int {
+	for _, field := range strings.Fields(header) {
+		if strings.HasPrefix(field, "+") {
+			start := strings.SplitN(field[1:], ",", 2)[0]
+			n, err := strconv.Atoi(start)
+			if err != nil {
+				return 0
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// exitOnHookFindings prints findings and exits non-zero so git aborts
+func exitOnHookFindings(findings []hookFinding, action string) {
+	if len(findings) == 0 {
+		return
+	}
+
+	printHookFindings(os.Stderr, findings)
+	fmt.Fprintf(os.Stderr, "\nsecretsanta-cli: %d high-confidence secret(s) found, aborting %s.\n", len(findings), action)
+	fmt.Fprintf(os.Stderr, "Remove them, or bypass this check with --no-verify if they are false positives.\n")
+	os.Exit(1)
+}
+
+// printHookFindings writes one line per finding
+func printHookFindings(w io.Writer, findings []hookFinding) {
+	for _, f := range findings {
+		location := fmt.Sprintf("%s:%d:%d", f.FilePath, f.Line, f.Column)
+		if f.Commit != "" {
+			location = fmt.Sprintf("%.12s %s", f.Commit, location)
+		}
+
+		secretDisplay := redactSecret(f.Secret, redactionMode())
+		if len(secretDisplay) > 100 {
+			secretDisplay = secretDisplay[:97] + "..."
+		}
+
+		fmt.Fprintf(w, "%s: %s: %s\n", location, f.PatternName, secretDisplay)
+	}
+}
+
+// shellQuote quotes a string for use in a POSIX shell script
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanUnifiedDiffMultiline(t *testing.T) {
+	added := "+" + strings.ReplaceAll(fixturePEM(2), "\n", "\n+")
+	diff := strings.Join([]string{
+		"\x00abc123",
+		"diff --git a/id_rsa.txt b/id_rsa.txt",
+		"--- a/id_rsa.txt",
+		"+++ b/id_rsa.txt",
+		"@@ -1,2 +1,6 @@",
+		" one",
+		added,
+		" two",
+		"",
+	}, "\n")
+
+	got := scanUnifiedDiff(diff, pemRules())
+	want := []hookFinding{{
+		Commit:      "abc123",
+		FilePath:    "id_rsa.txt",
+		Line:        2,
+		Column:      1,
+		PatternName: "Fixture private key",
+		RuleID:      "fixture-private-key",
+		Secret:      fixturePEM(2),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scanUnifiedDiff = %+v, want %+v", got, want)
+	}
+}
+
+func TestFilterHookFindings(t *testing.T) {
+	f := newFixtureRepo(t)
+	// The hook finds the repository's .secretsantaignore from the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(f.dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = &Config{AllowlistFile: filepath.Join(t.TempDir(), "allowlist")}
+
+	findings := scanUnifiedDiff(strings.Join([]string{
+		"\x00abc1234",
+		"+++ b/config.txt",
+		"@@ -0,0 +1,2 @@",
+		"+token = fixture_aaaaaaaa",
+		"+other = fixture_bbbbbbbb",
+		"",
+	}, "\n"), fixtureRules())
+
+	tests := []struct {
+		ignore, global string
+		want           []string // Secrets of the findings kept
+	}{
+		{"", "", []string{"fixture_aaaaaaaa", "fixture_bbbbbbbb"}},
+		{"pattern:fixture-token", "", nil},
+		{"pattern:Fixture token", "", nil},
+		{"", "pattern:fixture-token", nil},
+		{"pattern:other-token", "", []string{"fixture_aaaaaaaa", "fixture_bbbbbbbb"}},
+		{"fingerprint:" + secretFingerprint("fixture_aaaaaaaa"), "", []string{"fixture_bbbbbbbb"}},
+		{"commit:abc1234", "", nil},
+		{"", "config.txt", nil},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(f.dir, ignoreFileName), []byte(tt.ignore), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfg.AllowlistFile, []byte(tt.global), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, finding := range filterHookFindings(findings) {
+			got = append(got, finding.Secret)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterHookFindings with %q and global %q kept %q, want %q", tt.ignore, tt.global, got, tt.want)
+		}
+	}
+}
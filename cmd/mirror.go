@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// mirrorRefSpecs keep the branches and tags of a bare mirror identical to
+// the remote's; pull request heads are added with the pull ref scope
+var mirrorRefSpecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+// syncOptions controls how mirrors are cloned and updated
+type syncOptions struct {
+	Token     string
+	SinceDate string // Only fetch history after this date, YYYY-MM-DD
+	Depth     int    // Only fetch this many commits of each ref
+	Pull      bool   // Also fetch the head of every pull request
+}
+
+// shallowArgs returns the git fetch and clone arguments of a shallow sync
+func (o syncOptions) shallowArgs() []string {
+	var args []string
+	if o.SinceDate != "" {
+		args = append(args, "--shallow-since="+o.SinceDate)
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth="+strconv.Itoa(o.Depth))
+	}
+	return args
+}
+
+// syncMirror clones a repository into a bare mirror at dir, or updates the
+// mirror with a fetch of its refs that prunes the refs deleted upstream.
+// Mirrors have no worktree, so there is nothing to pull or to conflict.
+// SinceDate and Depth only apply to the clone: later fetches add the new
+// commits to a shallow mirror and keep a full one full.
+func syncMirror(dir, url string, opts syncOptions) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// A bare clone maps branches and tags like the mirror refspecs
+		// and points HEAD at the remote's default branch
+		args := append([]string{"clone", "--bare", "--quiet"}, opts.shallowArgs()...)
+		if err := runGit("", opts.Token, append(args, "--", url, dir)...); err != nil {
+			return err
+		}
+		if !opts.Pull {
+			return nil
+		}
+	}
+
+	args := append([]string{"fetch", "--quiet", "--prune", "--force", "--", url}, mirrorRefSpecs...)
+	if opts.Pull {
+		args = append(args, pullRefSpec)
+	}
+	return runGit(dir, opts.Token, args...)
+}
+
+// runGit runs git on the repository at dir, or in the current directory if
+// dir is empty, authenticating HTTPS requests with token. The
+// token is passed through the environment rather than the command line, so
+// other users can't see it in the process list.
+func runGit(dir, token string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"--git-dir", dir}, args...)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if token != "" {
+		// Username doesn't matter for GitHub token auth
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// migrateWorktree converts a clone with a worktree at worktreeDir, as
+// created by earlier versions, into a bare mirror at mirrorDir. The remote
+// tracking branches are dropped; the next sync replaces the local branches
+// with the remote's.
+func migrateWorktree(worktreeDir, mirrorDir string) error {
+	gitDir := filepath.Join(worktreeDir, ".git")
+	if info, err := os.Stat(gitDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a git worktree", worktreeDir)
+	}
+
+	if err := os.Rename(gitDir, mirrorDir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(worktreeDir); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(mirrorDir, "index"))
+
+	if err := runGit(mirrorDir, "", "config", "core.bare", "true"); err != nil {
+		return err
+	}
+
+	repo, err := git.PlainOpen(mirrorDir)
+	if err != nil {
+		return err
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+
+	var remotes []plumbing.ReferenceName
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsRemote() {
+			remotes = append(remotes, ref.Name())
+		}
+		return nil
+	})
+	for _, name := range remotes {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorDir returns where the mirror of a clone URL lives in reposDir,
+// migrating a worktree clone of an earlier version if there is one. Before
+// each target got its own directory, clones of every target were kept
+// directly in legacyDir; those are only taken over if their origin is
+// cloneURL, since another target may have a repository of the same name.
+func mirrorDir(reposDir, legacyDir, cloneURL string) string {
+	name := strings.TrimSuffix(filepath.Base(cloneURL), ".git")
+	dir := filepath.Join(reposDir, name+".git")
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+
+	worktree := filepath.Join(reposDir, name)
+	if _, err := os.Stat(filepath.Join(worktree, ".git")); err != nil {
+		worktree = filepath.Join(legacyDir, name)
+		if !isCloneOf(worktree, cloneURL) {
+			return dir
+		}
+	}
+
+	fmt.Printf("Converting worktree clone %s to a bare mirror...\n", worktree)
+	if err := migrateWorktree(worktree, dir); err != nil {
+		log.Printf("Error converting %s: %v", worktree, err)
+	}
+
+	return dir
+}
+
+// isCloneOf reports whether dir is a worktree clone whose origin is url
+func isCloneOf(dir, url string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return false
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return false
+	}
+	origin, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return false
+	}
+	return contains(origin.Config().URLs, url)
+}
+
+// shallowParents returns the parents of the commits at the boundary of a
+// shallow mirror, which aren't in the repository and which history walks
+// have to skip
+func shallowParents(repo *git.Repository) []plumbing.Hash {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil {
+		return nil
+	}
+
+	var parents []plumbing.Hash
+	for _, hash := range shallow {
+		c, err := repo.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		parents = append(parents, c.ParentHashes...)
+	}
+	return parents
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// worktreeClone builds a clone as earlier versions left it, with a worktree,
+// an origin and a remote tracking branch, at dir
+func worktreeClone(t *testing.T, dir, origin string) plumbing.Hash {
+	t.Helper()
+
+	f := newFixtureRepo(t)
+	head := f.commit("a.txt", "fixture_aaaaaaaa", time.Now())
+
+	if _, err := f.repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{origin}}); err != nil {
+		t.Fatal(err)
+	}
+	tracking := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "master"), head)
+	if err := f.repo.Storer.SetReference(tracking); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(f.dir, dir); err != nil {
+		t.Fatal(err)
+	}
+	return head
+}
+
+func TestMirrorDirMigration(t *testing.T) {
+	const cloneURL = "https://github.com/acme/widget.git"
+
+	tests := []struct {
+		name     string
+		clone    string // Worktree clone relative to the repos directory, if any
+		origin   string
+		migrated bool
+	}{
+		{"no clone", "", "", false},
+		// The baseline layout, ./repos/<name>
+		{"unslugged clone", "widget", cloneURL, true},
+		{"unslugged clone of another target", "widget", "https://github.com/other/widget.git", false},
+		{"target clone", "org-acme/widget", cloneURL, true},
+	}
+
+	for _, tt := range tests {
+		reposDir := t.TempDir()
+		targetDir := filepath.Join(reposDir, "org-acme")
+		if err := os.MkdirAll(targetDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		var head plumbing.Hash
+		if tt.clone != "" {
+			head = worktreeClone(t, filepath.Join(reposDir, tt.clone), tt.origin)
+		}
+
+		dir := mirrorDir(targetDir, reposDir, cloneURL)
+		if want := filepath.Join(targetDir, "widget.git"); dir != want {
+			t.Errorf("%s: mirrorDir = %s, want %s", tt.name, dir, want)
+		}
+
+		repo, err := git.PlainOpen(dir)
+		if !tt.migrated {
+			if err == nil {
+				t.Errorf("%s: %s was created", tt.name, dir)
+			}
+			if tt.clone != "" {
+				if _, err := os.Stat(filepath.Join(reposDir, tt.clone, ".git")); err != nil {
+					t.Errorf("%s: clone was removed: %v", tt.name, err)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: opening mirror: %v", tt.name, err)
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(reposDir, tt.clone)); !os.IsNotExist(err) {
+			t.Errorf("%s: worktree clone is still there", tt.name)
+		}
+
+		cfg, err := repo.Config()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cfg.Core.IsBare {
+			t.Errorf("%s: mirror isn't bare", tt.name)
+		}
+
+		if ref, err := repo.Reference(plumbing.Master, false); err != nil || ref.Hash() != head {
+			t.Errorf("%s: master = %v, %v, want %s", tt.name, ref, err, head)
+		}
+		if _, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "master"), false); err == nil {
+			t.Errorf("%s: remote tracking branch was kept", tt.name)
+		}
+
+		// Later runs use the mirror as it is
+		if again := mirrorDir(targetDir, reposDir, cloneURL); again != dir {
+			t.Errorf("%s: second mirrorDir = %s, want %s", tt.name, again, dir)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minKeywordLength is the shortest literal worth prefiltering on; shorter
+// ones are found on almost every line
+const minKeywordLength = 3
+
+// maxKeywords caps the alternatives extracted from one rule
+const maxKeywords = 64
+
+// prefilter selects the rules worth running on a piece of text: a rule with
+// keywords only runs if the text contains one of them, case-insensitively.
+// Rules without keywords always run.
+type prefilter struct {
+	matcher      *ahoCorasick
+	keywordRules [][]int // Rule indices by keyword index
+	always       []int   // Rules without keywords
+	size         int     // Number of rules
+}
+
+// newPrefilter builds a prefilter from the keywords of each rule; a nil or
+// empty entry means the rule has none
+func newPrefilter(ruleKeywords [][]string) *prefilter {
+	p := &prefilter{size: len(ruleKeywords)}
+
+	index := make(map[string]int)
+	var keywords []string
+	for rule, words := range ruleKeywords {
+		if len(words) == 0 {
+			p.always = append(p.always, rule)
+			continue
+		}
+
+		for _, word := range words {
+			word = strings.ToLower(word)
+			k, ok := index[word]
+			if !ok {
+				k = len(keywords)
+				index[word] = k
+				keywords = append(keywords, word)
+				p.keywordRules = append(p.keywordRules, nil)
+			}
+			p.keywordRules[k] = append(p.keywordRules[k], rule)
+		}
+	}
+
+	p.matcher = newAhoCorasick(keywords)
+	return p
+}
+
+// candidates returns the indices of the rules to run on text, in rule order
+func (p *prefilter) candidates(text string) []int {
+	rules := append([]int(nil), p.always...)
+
+	matched := false
+	p.matcher.search(text, func(keyword int) {
+		rules = append(rules, p.keywordRules[keyword]...)
+		matched = true
+	})
+	if !matched {
+		return rules
+	}
+
+	sort.Ints(rules)
+	unique := rules[:1]
+	for _, rule := range rules[1:] {
+		if rule != unique[len(unique)-1] {
+			unique = append(unique, rule)
+		}
+	}
+	return unique
+}
+
+// filtered returns how many rules have keywords
+func (p *prefilter) filtered() int {
+	return p.size - len(p.always)
+}
+
+// ruleKeywords returns the keywords a rule is prefiltered on: the rule's own
+// keywords if it declares any, otherwise literals extracted from its regex.
+// It returns nil if the rule has to run on every line.
+func ruleKeywords(pattern YamlPattern, re *regexp.Regexp) []string {
+	if len(pattern.Keywords) > 0 {
+		return pattern.Keywords
+	}
+
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+
+	literals := requiredLiterals(parsed.Simplify())
+	for _, literal := range literals {
+		if len(literal) < minKeywordLength || !isASCII(literal) {
+			return nil
+		}
+	}
+	return literals
+}
+
+// requiredLiterals returns a set of literals one of which every match of re
+// contains, lowercased, or nil if there is no such set
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{strings.ToLower(string(re.Rune))}
+
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return requiredLiterals(re.Sub[0])
+
+	case syntax.OpAlternate:
+		var literals []string
+		for _, sub := range re.Sub {
+			subLiterals := requiredLiterals(sub)
+			if subLiterals == nil {
+				return nil
+			}
+			literals = appendUnique(literals, subLiterals...)
+		}
+		if len(literals) > maxKeywords {
+			return nil
+		}
+		return literals
+
+	case syntax.OpConcat:
+		// Adjacent literals form one longer literal, e.g. "ab" "c" -> "abc"
+		var best []string
+		var run strings.Builder
+		consider := func(literals []string) {
+			if literals != nil && (best == nil || betterLiterals(literals, best)) {
+				best = literals
+			}
+		}
+
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				run.WriteString(strings.ToLower(string(sub.Rune)))
+				continue
+			}
+			if run.Len() > 0 {
+				consider([]string{run.String()})
+				run.Reset()
+			}
+			consider(requiredLiterals(sub))
+		}
+		if run.Len() > 0 {
+			consider([]string{run.String()})
+		}
+		return best
+	}
+
+	return nil
+}
+
+// betterLiterals reports whether literal set a filters better than b: its
+// shortest literal is longer, or as long with fewer alternatives
+func betterLiterals(a, b []string) bool {
+	shortest := func(literals []string) int {
+		n := len(literals[0])
+		for _, literal := range literals[1:] {
+			n = min(n, len(literal))
+		}
+		return n
+	}
+
+	if shortest(a) != shortest(b) {
+		return shortest(a) > shortest(b)
+	}
+	return len(a) < len(b)
+}
+
+// appendUnique appends the values not in list yet
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// isASCII reports whether s only has ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ahoCorasick finds ASCII keywords in text in a single pass, ignoring case.
+// The automaton is a full DFA over byte classes: bytes that appear in no
+// keyword share one class.
+type ahoCorasick struct {
+	classes    [256]int32
+	numClasses int32
+	delta      []int32   // Next state, by state*numClasses+class
+	out        [][]int32 // Keywords ending in each state
+}
+
+// newAhoCorasick builds the automaton for lowercased ASCII keywords
+func newAhoCorasick(keywords []string) *ahoCorasick {
+	ac := &ahoCorasick{numClasses: 1}
+	for _, keyword := range keywords {
+		for i := 0; i < len(keyword); i++ {
+			if ac.classes[keyword[i]] == 0 {
+				ac.classes[keyword[i]] = ac.numClasses
+				ac.numClasses++
+			}
+		}
+	}
+	// Uppercase ASCII letters share the class of their lowercase letter
+	for c := 'A'; c <= 'Z'; c++ {
+		ac.classes[c] = ac.classes[c+'a'-'A']
+	}
+
+	n := ac.numClasses
+	newState := func() int32 {
+		ac.delta = append(ac.delta, make([]int32, n)...)
+		ac.out = append(ac.out, nil)
+		return int32(len(ac.out) - 1)
+	}
+	newState()
+
+	// Trie; -1 marks a missing edge until the failure links fill it in
+	for i := range ac.delta {
+		ac.delta[i] = -1
+	}
+	for k, keyword := range keywords {
+		state := int32(0)
+		for i := 0; i < len(keyword); i++ {
+			c := ac.classes[keyword[i]]
+			if ac.delta[state*n+c] < 0 {
+				next := newState()
+				for j := next * n; j < (next+1)*n; j++ {
+					ac.delta[j] = -1
+				}
+				ac.delta[state*n+c] = next
+			}
+			state = ac.delta[state*n+c]
+		}
+		ac.out[state] = append(ac.out[state], int32(k))
+	}
+
+	// Breadth-first, turn missing edges into the failure state's edges
+	fail := make([]int32, len(ac.out))
+	var queue []int32
+	for c := int32(0); c < n; c++ {
+		next := ac.delta[c]
+		if next < 0 {
+			ac.delta[c] = 0
+			continue
+		}
+		queue = append(queue, next)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ac.out[state] = append(ac.out[state], ac.out[fail[state]]...)
+
+		for c := int32(0); c < n; c++ {
+			next := ac.delta[state*n+c]
+			if next < 0 {
+				ac.delta[state*n+c] = ac.delta[fail[state]*n+c]
+				continue
+			}
+			fail[next] = ac.delta[fail[state]*n+c]
+			queue = append(queue, next)
+		}
+	}
+
+	return ac
+}
+
+// search calls found with the index of every keyword occurrence in text
+func (ac *ahoCorasick) search(text string, found func(keyword int)) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		state = ac.delta[state*ac.numClasses+ac.classes[text[i]]]
+		for _, k := range ac.out[state] {
+			found(int(k))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"reflect"
+	"regexp/syntax"
+	"strings"
+	"testing"
+)
+
+func TestAhoCorasickSearch(t *testing.T) {
+	tests := []struct {
+		keywords []string
+		text     string
+		want     []string // Keywords found, in the order search reports them
+	}{
+		// Overlapping keywords, including one that is a suffix of another
+		{[]string{"he", "she", "his", "hers"}, "ushers", []string{"she", "he", "hers"}},
+		{[]string{"he", "she", "his", "hers"}, "ahishe", []string{"his", "she", "he"}},
+		{[]string{"aa"}, "aaaa", []string{"aa", "aa", "aa"}},
+		{[]string{"abcd", "bc"}, "abce", []string{"bc"}},
+
+		// Case folding
+		{[]string{"token"}, "API_TOKEN=x", []string{"token"}},
+		{[]string{"token"}, "ToKeN", []string{"token"}},
+
+		// Bytes in no keyword share a class and reset the match
+		{[]string{"he"}, "h-e h\xffe h e", nil},
+		{[]string{"-----begin"}, "x-----BEGIN RSA", []string{"-----begin"}},
+		{[]string{"ghp_"}, "ghp-ghp_", []string{"ghp_"}},
+		{[]string{"key"}, "\x00k\x00e\x00y", nil},
+
+		{nil, "anything", nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		newAhoCorasick(tt.keywords).search(tt.text, func(keyword int) {
+			got = append(got, tt.keywords[keyword])
+		})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) with %q = %q, want %q", tt.text, tt.keywords, got, tt.want)
+		}
+	}
+}
+
+func TestPrefilterCandidates(t *testing.T) {
+	p := newPrefilter([][]string{
+		{"aws", "AKIA"},
+		nil,
+		{"ghp_"},
+		{"akia"},
+	})
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"nothing to see", []int{1}},
+		{"key = akiaXYZ", []int{0, 1, 3}},
+		{"AWS_KEY=AKIA ghp_x", []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := p.candidates(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("candidates(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	if got := p.filtered(); got != 3 {
+		t.Errorf("filtered() = %d, want 3", got)
+	}
+}
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{`ghp_[A-Za-z0-9]{36}`, []string{"ghp_"}},
+		{`(?i)SECRET`, []string{"secret"}},
+
+		// Alternation needs a literal in every branch
+		{`(aws|gcp)[0-9]+`, []string{"aws", "gcp"}},
+		{`xoxb|ghp_|akia`, []string{"xoxb", "ghp_", "akia"}},
+		// The parser factors out the common prefix x
+		{`xoxb|xoxp|xapp`, []string{"ox", "app"}},
+		{`(aws|[0-9])`, nil},
+		{`(aws|[0-9])x`, []string{"x"}},
+		{`(aws|gcp|[0-9]+)`, nil},
+
+		// Concatenation keeps the literal that filters best
+		{`[a-z]+_token_[0-9]+`, []string{"_token_"}},
+		{`(key|secret)=["']?[a-z0-9]{32}_x`, []string{"key", "secret"}},
+		{`(ab|cd)[0-9]+longer`, []string{"longer"}},
+		{`[0-9]+`, nil},
+
+		// Optional parts can't be required
+		{`(prefix)?[0-9]{8}`, nil},
+		{`(prefix)?_suffix`, []string{"_suffix"}},
+		{`(abc)*def`, []string{"def"}},
+		{`(abc){0,3}[0-9]`, nil},
+		{`(abc)+[0-9]`, []string{"abc"}},
+		{`(abc){2,}[0-9]`, []string{"abc"}},
+	}
+
+	for _, tt := range tests {
+		re, err := syntax.Parse(tt.pattern, syntax.Perl)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tt.pattern, err)
+		}
+		if got := requiredLiterals(re.Simplify()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("requiredLiterals(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// benchmarkScanDiff scans a lintSample corpus in 20-line chunks, as a diff
+// of many small hunks, with the default rules
+func benchmarkScanDiff(b *testing.B, prefiltered bool) {
+	rules, err := loadPatterns(nil, ruleSelection{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !prefiltered {
+		unfiltered := *rules
+		unfiltered.filter, unfiltered.multilineFilter = nil, nil
+		rules = &unfiltered
+	}
+
+	const chunkLines = 20
+	lines := strings.Split(lintSample(256<<10), "\n")
+	var chunks []string
+	for start := 0; start < len(lines); start += chunkLines {
+		chunks = append(chunks, strings.Join(lines[start:min(start+chunkLines, len(lines))], "\n"))
+	}
+
+	b.SetBytes(256 << 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, chunk := range chunks {
+			scanDiffForSecrets(chunk, rules)
+		}
+	}
+}
+
+func BenchmarkScanDiffUnfiltered(b *testing.B) {
+	benchmarkScanDiff(b, false)
+}
+
+func BenchmarkScanDiffPrefiltered(b *testing.B) {
+	benchmarkScanDiff(b, true)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// Redaction modes for secret values written to reports
+const (
+	redactFull    = "full"    // Replace the value entirely
+	redactPartial = "partial" // Keep the first and last 4 characters
+	redactHash    = "hash"    // Replace the value with its SHA-256 fingerprint
+	redactNone    = "none"    // Plaintext, only with --show-secrets
+)
+
+var redactionModes = []string{redactFull, redactPartial, redactHash}
+
+// showSecrets is set by --show-secrets; it is deliberately not a config
+// setting so plaintext output always needs an explicit flag
+var showSecrets bool
+
+// redactionMode returns the mode applied to reports for this invocation
+func redactionMode() string {
+	if showSecrets {
+		return redactNone
+	}
+	return cfg.Redact
+}
+
+// secretFingerprint returns a stable identifier for a secret value that can
+// be shared without disclosing it
+func secretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// findingFingerprint returns the fingerprint of a finding's secret. Findings
+// saved by older versions may lack one; their secrets are only redacted after
+// redactFindings fills it in, so it can be computed from the secret.
+func findingFingerprint(match SecretMatch) string {
+	if match.Fingerprint != "" {
+		return match.Fingerprint
+	}
+	return secretFingerprint(match.Secret)
+}
+
+// redactSecret hides a secret value according to mode
+func redactSecret(secret, mode string) string {
+	switch mode {
+	case redactNone:
+		return secret
+	case redactHash:
+		return secretFingerprint(secret)
+	case redactPartial:
+		// Too short to show anything without revealing most of it
+		if len(secret) <= 12 {
+			return strings.Repeat("*", len(secret))
+		}
+		return secret[:4] + strings.Repeat("*", 8) + secret[len(secret)-4:]
+	default:
+		return "[REDACTED]"
+	}
+}
+
+// redactFindings returns copies of findings with their secret values redacted
+func redactFindings(findings []SecretMatch, mode string) []SecretMatch {
+	if mode == redactNone {
+		return findings
+	}
+
+	redacted := make([]SecretMatch, len(findings))
+	for i, match := range findings {
+		match.Fingerprint = findingFingerprint(match)
+		match.Secret = redactSecret(match.Secret, mode)
+		redacted[i] = match
+	}
+	return redacted
+}
+
+// openPrivate opens a report file readable only by its owner, tightening the
+// permissions of files created by older versions
+func openPrivate(path string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Ref scopes selected with scan --refs
+const (
+	refScopeLocal  = "local"  // Local branches
+	refScopeRemote = "remote" // Remote-tracking branches
+	refScopeTags   = "tags"
+	refScopePull   = "pull"  // GitHub pull request heads, fetched only with this scope
+	refScopeStash  = "stash" // The latest stash
+)
+
+// refScopePrefixes maps each ref scope to the ref names it covers
+var refScopePrefixes = map[string]string{
+	refScopeLocal:  "refs/heads/",
+	refScopeRemote: "refs/remotes/",
+	refScopeTags:   "refs/tags/",
+	refScopePull:   "refs/pull/",
+	refScopeStash:  "refs/stash",
+}
+
+// defaultRefScopes are scanned unless --refs says otherwise
+var defaultRefScopes = []string{refScopeLocal, refScopeRemote, refScopeTags}
+
+// pullRefSpec fetches the head of every pull request
+const pullRefSpec = "+refs/pull/*/head:refs/pull/*/head"
+
+// validateRefScopes checks the scopes given with --refs
+func validateRefScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("no ref scopes given, use --refs with %s", strings.Join(refScopeNames(), ", "))
+	}
+	for _, scope := range scopes {
+		if _, ok := refScopePrefixes[scope]; !ok {
+			return fmt.Errorf("invalid ref scope %q, must be one of %s", scope, strings.Join(refScopeNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// refScopeNames returns the ref scopes in order
+func refScopeNames() []string {
+	return []string{refScopeLocal, refScopeRemote, refScopeTags, refScopePull, refScopeStash}
+}
+
+// inRefScopes reports whether a ref is covered by one of scopes
+func inRefScopes(name string, scopes []string) bool {
+	for _, scope := range scopes {
+		prefix := refScopePrefixes[scope]
+		if name == prefix || strings.HasSuffix(prefix, "/") && strings.HasPrefix(name, prefix) {
+			// Only the head of a pull request, not its merge ref
+			return scope != refScopePull || strings.HasSuffix(name, "/head")
+		}
+	}
+	return false
+}
+
+// refTips returns the commit hash of every ref in scopes by ref name.
+// Annotated tags are peeled to their commit; refs that don't point to a
+// commit, such as tags of trees or blobs, and symbolic refs are skipped.
+func refTips(repo *git.Repository, scopes []string) (map[string]string, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("getting refs: %v", err)
+	}
+
+	tips := make(map[string]string)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference || !inRefScopes(name, scopes) {
+			return nil
+		}
+
+		hash := ref.Hash()
+		if tag, err := repo.TagObject(hash); err == nil {
+			c, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = c.Hash
+		} else if _, err := repo.CommitObject(hash); err != nil {
+			return nil
+		}
+
+		tips[name] = hash.String()
+		return nil
+	})
+	return tips, err
+}
+
+// refsReaching returns the refs from which each of commits is reachable, by
+// commit. children links the commits walked by a scan to their children and
+// every path from a tip to a scanned commit only has scanned commits, so the
+// refs are found by walking up from each commit.
+func refsReaching(commits []plumbing.Hash, tips map[string]string, children map[plumbing.Hash][]plumbing.Hash) map[plumbing.Hash][]string {
+	refsByTip := make(map[plumbing.Hash][]string)
+	for name, tip := range tips {
+		hash := plumbing.NewHash(tip)
+		refsByTip[hash] = append(refsByTip[hash], name)
+	}
+
+	reaching := make(map[plumbing.Hash][]string)
+	for _, commit := range commits {
+		if _, done := reaching[commit]; done {
+			continue
+		}
+
+		var refs []string
+		visited := map[plumbing.Hash]bool{commit: true}
+		queue := []plumbing.Hash{commit}
+		for len(queue) > 0 {
+			hash := queue[0]
+			queue = queue[1:]
+			refs = append(refs, refsByTip[hash]...)
+
+			for _, child := range children[hash] {
+				if !visited[child] {
+					visited[child] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+
+		sort.Strings(refs)
+		reaching[commit] = refs
+	}
+	return reaching
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Regenerate the report from saved findings",
+	Long: `Report rebuilds the report from the findings saved by previous scan runs,
+without cloning or scanning any repository. Each --org and --user target gets
+its own report; existing report files are overwritten.
+
+Secret values are redacted according to --redact; pass --show-secrets to
+write them in plaintext.
+
+--format selects markdown, json, jsonl, sarif (2.1.0, for code scanning
+dashboards) or csv output.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := parseTargets(cfg.Orgs, cfg.Users)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, target := range targets {
+			findingsPath := targetFile(cfg.FindingsFile, target)
+			outputPath := targetFile(cfg.OutputFile, target)
+
+			findings, err := loadFindings(findingsPath)
+			if err != nil {
+				log.Fatalf("Error loading findings for %s: %v", target, err)
+			}
+
+			if err := writeOutput(cfg.Format, outputPath, findings); err != nil {
+				log.Fatalf("Error writing report for %s: %v", target, err)
+			}
+
+			fmt.Printf("Wrote %d findings to %s\n", len(findings), outputPath)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+}
+
+// loadFindings reads all saved findings, returning none if the file doesn't exist yet
+func loadFindings(path string) ([]SecretMatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var doc FindingsDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshaling findings: %v", err)
+	}
+
+	if doc.SchemaVersion != findingsSchemaVersion {
+		return nil, fmt.Errorf("findings file %s has schema version %d, expected %d", path, doc.SchemaVersion, findingsSchemaVersion)
+	}
+
+	return doc.Findings, nil
+}
+
+// appendFindings adds new findings to the findings file, skipping the ones
+// it already has, e.g. after a full-history rescan
+func appendFindings(path string, findings []SecretMatch) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	existing, err := loadFindings(path)
+	if err != nil {
+		return err
+	}
+
+	saved := make(map[string]bool, len(existing))
+	for _, match := range existing {
+		saved[findingKey(match)] = true
+	}
+	for _, match := range findings {
+		if !saved[findingKey(match)] {
+			existing = append(existing, match)
+			saved[findingKey(match)] = true
+		}
+	}
+
+	data, err := json.MarshalIndent(FindingsDocument{
+		SchemaVersion: findingsSchemaVersion,
+		Findings:      existing,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Findings keep plaintext secrets so reports can be regenerated in any mode
+	return os.WriteFile(path, data, 0600)
+}
+
+// findingKey identifies a finding by where it was found, so rescanning a
+// commit yields the same key
+func findingKey(match SecretMatch) string {
+	return strings.Join([]string{
+		match.RepoURL, match.CommitHash, match.FilePath, strconv.Itoa(match.Line),
+		strconv.Itoa(match.Column), match.PatternName, strconv.FormatBool(match.Removed),
+	}, "\x00")
+}
+
+// writeReport writes a fresh report containing all given findings
+func writeReport(outputFile string, findings, suppressed []SecretMatch) error {
+	f, err := openPrivate(outputFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("# Secret Scanning Results\n\n")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(fmt.Sprintf("## Regenerated Report - %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
+	if err != nil {
+		return err
+	}
+
+	if err := writeSuppressedNote(f, suppressed); err != nil {
+		return err
+	}
+
+	return writeFindings(f, findings)
+}
+
+// blobURL links to a line of a file at a commit on GitHub, or returns "" if
+// the repository isn't hosted on GitHub (e.g. a local path)
+func blobURL(repoURL, commit, filePath string, line int) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host != "github.com" || commit == "" || filePath == "" {
+		return ""
+	}
+
+	repoPath := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	link := fmt.Sprintf("https://github.com%s/blob/%s/%s", repoPath, commit, (&url.URL{Path: filePath}).EscapedPath())
+	if line > 0 {
+		link += fmt.Sprintf("#L%d", line)
+	}
+
+	return link
+}
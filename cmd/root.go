@@ -5,24 +5,35 @@ package cmd
 
 import (
 	"os"
-	// "secretsanta-cli/local"
 
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "secretsanta-cli",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
+	Short: "Scan GitHub organization and user repositories for leaked secrets",
+	Long: `secretsanta-cli clones the repositories of GitHub organizations and users
+and scans their commit history for leaked secrets using the built-in rules or
+the rules files given with --rules (see "secretsanta-cli rules help"). Targets
+are selected with --org and --user.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+The work is split into steps that can be scripted separately:
 
-	Run: func(cmd *cobra.Command, args []string) {
-		// local.FetchAndCacheRepos()
-		run()
+  secretsanta-cli fetch-repos   refresh the cached list of repositories
+  secretsanta-cli scan          clone/update repositories and scan new commits
+  secretsanta-cli report        regenerate the report from saved findings
+
+Settings are read from $HOME/.secretsanta-cli.yaml (or --config), then
+SECRETSANTA_* environment variables, then flags. Run "secretsanta-cli config
+show" to print the resolved settings.
+
+Secret values in reports are partially redacted by default (see --redact),
+and report files are created readable by their owner only.`,
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		cfg, err = loadConfig(cmd)
+		return err
 	},
 }
 
@@ -40,9 +51,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.secretsanta-cli.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.secretsanta-cli.yaml)")
+	addSettingFlags(rootCmd)
+	rootCmd.PersistentFlags().StringVar(&flagCfg.ScanInterval, "scan-interval", "", "ignored")
+	rootCmd.PersistentFlags().MarkDeprecated("scan-interval", "repositories new to the scan state get a full-history scan")
+	rootCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "write secret values in plaintext instead of redacting them")
 }
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// delimitedRegex matches PCRE-style /pattern/flags rules
+var delimitedRegex = regexp.MustCompile(`(?s)^/(.*)/([A-Za-z]*)$`)
+
+// compiledRule is a rule's regex after translation to RE2 syntax
+type compiledRule struct {
+	re      *regexp.Regexp
+	changes []string // How the regex had to be rewritten to compile
+}
+
+// compileRule translates a rule's regex to Go's RE2 syntax and compiles it.
+// It accepts /pattern/flags, maps the i, m and s flags to inline flags and
+// rewrites possessive quantifiers, atomic groups and lookarounds at the start
+// or end of the pattern. Multi-line rules always get the m flag. The error
+// explains why a rule can't be used.
+func compileRule(source string, multiline bool) (*compiledRule, error) {
+	pattern, flags := source, ""
+	if m := delimitedRegex.FindStringSubmatch(source); m != nil {
+		pattern, flags = m[1], m[2]
+	}
+
+	var changes []string
+	inline := ""
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 'm', 's':
+			if !strings.ContainsRune(inline, flag) {
+				inline += string(flag)
+			}
+		case 'g':
+			changes = append(changes, "dropped the g flag, every match is reported anyway")
+		case 'u':
+			changes = append(changes, "dropped the u flag, Go regexps are always UTF-8")
+		default:
+			return nil, fmt.Errorf("unsupported flag %q", flag)
+		}
+	}
+
+	// ^ and $ of multi-line rules anchor at line boundaries within the text
+	if multiline && !strings.Contains(inline, "m") {
+		inline += "m"
+	}
+
+	pattern, rewrites, err := rewritePCRE(pattern)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, rewrites...)
+
+	if inline != "" {
+		pattern = "(?" + inline + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if re.MatchString("") {
+		return nil, errors.New("matches the empty string")
+	}
+
+	return &compiledRule{re: re, changes: changes}, nil
+}
+
+// rewritePCRE rewrites the PCRE constructs of pattern that have an RE2
+// equivalent, or one that only widens the match, and rejects the others
+func rewritePCRE(pattern string) (string, []string, error) {
+	var b strings.Builder
+	var changes []string
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			next := pattern[i+1]
+			switch {
+			case next >= '1' && next <= '9', next == 'k', next == 'g':
+				return "", nil, fmt.Errorf("backreference \\%c is not supported", next)
+			case next == 'Z':
+				b.WriteString(`\z`)
+				changes = append(changes, `replaced \Z with \z`)
+			case next == 'h':
+				b.WriteString(`[\t ]`)
+				changes = append(changes, `replaced \h with [\t ]`)
+			default:
+				b.WriteString(pattern[i : i+2])
+			}
+			i++
+
+		case c == '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				return "", nil, errors.New("unterminated character class")
+			}
+			b.WriteString(pattern[i : end+1])
+			i = end
+
+		case c == '(' && strings.HasPrefix(pattern[i:], "(?>"):
+			b.WriteString("(?:")
+			i += 2
+			changes = append(changes, "made an atomic group (?>...) a plain group")
+
+		case c == '(' && isLookaround(pattern[i:]):
+			end := groupEnd(pattern, i)
+			if end < 0 {
+				return "", nil, errors.New("unterminated group")
+			}
+
+			rewritten, change, err := rewriteLookaround(pattern, i, end)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString(rewritten)
+			changes = append(changes, change)
+			i = end
+
+		case (c == '+' || c == '*' || c == '?' || c == '}') && i+1 < len(pattern) && pattern[i+1] == '+' && !isGroupStart(pattern, i):
+			b.WriteByte(c)
+			i++
+			changes = append(changes, fmt.Sprintf("made the possessive quantifier %c+ greedy", c))
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), changes, nil
+}
+
+// isGroupStart reports whether the ? at i opens a group, as in "(?"
+func isGroupStart(pattern string, i int) bool {
+	return pattern[i] == '?' && i > 0 && pattern[i-1] == '('
+}
+
+// isLookaround reports whether s starts with a lookahead or lookbehind
+func isLookaround(s string) bool {
+	for _, prefix := range []string{"(?=", "(?!", "(?<=", "(?<!"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteLookaround replaces the lookaround pattern[start:end+1]. Only a
+// lookbehind at the start and a lookahead at the end of the pattern can be
+// rewritten: positive ones become part of the match, negative ones over a
+// single character become a negated class or the pattern boundary.
+func rewriteLookaround(pattern string, start, end int) (string, string, error) {
+	group := pattern[start : end+1]
+
+	prefixLen := 3
+	behind := strings.HasPrefix(group, "(?<")
+	if behind {
+		prefixLen = 4
+	}
+	negative := group[prefixLen-1] == '!'
+	inner := group[prefixLen : len(group)-1]
+
+	atStart := start == 0 || (start == 1 && pattern[0] == '^')
+	atEnd := end == len(pattern)-1 || (end == len(pattern)-2 && pattern[len(pattern)-1] == '$')
+
+	if behind && !atStart || !behind && !atEnd {
+		return "", "", fmt.Errorf("lookaround %s is not at the start or end of the pattern", group)
+	}
+
+	inner, _, err := rewritePCRE(inner)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !negative {
+		return "(?:" + inner + ")", fmt.Sprintf("made the lookaround %s part of the match", group), nil
+	}
+
+	negated, ok := negateSingleChar(inner)
+	if !ok {
+		return "", "", fmt.Errorf("negative lookaround %s can only be rewritten for a single character", group)
+	}
+
+	rewritten := "(?:" + negated + "|$)"
+	if behind {
+		rewritten = "(?:^|" + negated + ")"
+	}
+	return rewritten, fmt.Sprintf("replaced the lookaround %s with %s, which is part of the match", group, rewritten), nil
+}
+
+// negateSingleChar returns a class matching any character that expr, a single
+// character, escape or class, doesn't match
+func negateSingleChar(expr string) (string, bool) {
+	switch {
+	case len(expr) == 2 && expr[0] == '\\':
+		switch expr[1] {
+		case 'w', 'd', 's':
+			return `\` + strings.ToUpper(expr[1:]), true
+		case 'W', 'D', 'S':
+			return `\` + strings.ToLower(expr[1:]), true
+		case 'b', 'B', 'A', 'z':
+			return "", false
+		}
+		return `[^` + expr + `]`, true
+	case strings.HasPrefix(expr, "[") && classEnd(expr, 0) == len(expr)-1:
+		if strings.HasPrefix(expr, "[^") {
+			return "[" + expr[2:], true
+		}
+		return "[^" + expr[1:], true
+	case len(expr) == 1 && !strings.ContainsAny(expr, `.^$|()[]{}*+?`):
+		return "[^" + regexp.QuoteMeta(expr) + "]", true
+	}
+	return "", false
+}
+
+// classEnd returns the index of the ] closing the character class at start, or -1
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	// A ] right after [ or [^ is a literal
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			// POSIX classes such as [:alpha:]
+			if i+1 < len(pattern) && pattern[i+1] == ':' {
+				if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+					i += end + 3
+				}
+			}
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// groupEnd returns the index of the ) closing the group at start, or -1
+func groupEnd(pattern string, start int) int {
+	depth := 0
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
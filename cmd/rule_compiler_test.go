@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		source    string
+		multiline bool
+		want      string // Compiled regex, empty if an error is expected
+		wantErr   string
+	}{
+		{source: `abc[0-9]+`, want: `abc[0-9]+`},
+		{source: `/abc/i`, want: `(?i)abc`},
+		{source: `/abc/gimsu`, want: `(?ims)abc`},
+		{source: `/abc/ii`, want: `(?i)abc`},
+		{source: `/abc/x`, wantErr: `unsupported flag 'x'`},
+		{source: `-----BEGIN`, multiline: true, want: `(?m)-----BEGIN`},
+		{source: `/^key$/m`, multiline: true, want: `(?m)^key$`},
+		// Slashes inside a plain regex aren't delimiters
+		{source: `https://[a-z]+`, want: `https://[a-z]+`},
+
+		{source: `a*`, wantErr: "matches the empty string"},
+		{source: `(foo)?`, wantErr: "matches the empty string"},
+		{source: `/x?/i`, wantErr: "matches the empty string"},
+		// The old JWK rule, which matched any line of base64
+		{source: `/^(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$/gm`, multiline: true, wantErr: "matches the empty string"},
+	}
+
+	for _, tt := range tests {
+		compiled, err := compileRule(tt.source, tt.multiline)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileRule(%q) error = %v, want %q", tt.source, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("compileRule(%q): %v", tt.source, err)
+			continue
+		}
+		if got := compiled.re.String(); got != tt.want {
+			t.Errorf("compileRule(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+// TestDefaultRules checks that every default rule compiles and matches its
+// examples, as "rules lint" and "rules test" do
+func TestDefaultRules(t *testing.T) {
+	patterns, err := readRules(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pattern := range patterns {
+		rule, err := compileRule(pattern.Regex, pattern.Multiline)
+		if err != nil {
+			t.Errorf("rule %s: %v", pattern.Name, err)
+			continue
+		}
+		for _, example := range pattern.Examples {
+			if !ruleMatches(rule, pattern.Multiline, example) {
+				t.Errorf("rule %s: example %q doesn't match", pattern.Name, example)
+			}
+		}
+		for _, example := range pattern.CounterExamples {
+			if ruleMatches(rule, pattern.Multiline, example) {
+				t.Errorf("rule %s: counter-example %q matches", pattern.Name, example)
+			}
+		}
+	}
+}
+
+func TestRewritePCRE(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		changes int
+		wantErr string
+	}{
+		{pattern: `key_[a-z]{32}`, want: `key_[a-z]{32}`},
+
+		// Possessive quantifiers and atomic groups
+		{pattern: `a++b*+c?+d{2}+`, want: `a+b*c?d{2}`, changes: 4},
+		{pattern: `(?>abc)+`, want: `(?:abc)+`, changes: 1},
+		{pattern: `(?:a)+`, want: `(?:a)+`},
+		{pattern: `[a++]`, want: `[a++]`},
+		{pattern: `\++`, want: `\++`},
+
+		// Lookarounds at the start or end of the pattern
+		{pattern: `(?<=key=)[a-z]+`, want: `(?:key=)[a-z]+`, changes: 1},
+		{pattern: `^(?<=key=)[a-z]+`, want: `^(?:key=)[a-z]+`, changes: 1},
+		{pattern: `[a-z]+(?=")`, want: `[a-z]+(?:")`, changes: 1},
+		{pattern: `[a-z]+(?=")$`, want: `[a-z]+(?:")$`, changes: 1},
+		{pattern: `(?<![a-z])[0-9]+`, want: `(?:^|[^a-z])[0-9]+`, changes: 1},
+		{pattern: `[0-9]+(?![^a-z])`, want: `[0-9]+(?:[a-z]|$)`, changes: 1},
+		{pattern: `[0-9]+(?!\w)`, want: `[0-9]+(?:\W|$)`, changes: 1},
+		{pattern: `[0-9]+(?!\S)`, want: `[0-9]+(?:\s|$)`, changes: 1},
+		{pattern: `[0-9]+(?!x)`, want: `[0-9]+(?:[^x]|$)`, changes: 1},
+		{pattern: `[0-9]+(?!\.)`, want: `[0-9]+(?:[^\.]|$)`, changes: 1},
+		{pattern: `[0-9]+(?=[a-z]++)`, want: `[0-9]+(?:[a-z]+)`, changes: 1},
+
+		// Lookarounds in the middle, or the wrong way round
+		{pattern: `a(?=b)c`, wantErr: "not at the start or end"},
+		{pattern: `a(?<=b)`, wantErr: "not at the start or end"},
+		{pattern: `(?=a)b`, wantErr: "not at the start or end"},
+		{pattern: `a(?!bc)`, wantErr: "only be rewritten for a single character"},
+		{pattern: `a(?!\b)`, wantErr: "only be rewritten for a single character"},
+		{pattern: `a(?=b`, wantErr: "unterminated group"},
+
+		// Other escapes
+		{pattern: `a\Z`, want: `a\z`, changes: 1},
+		{pattern: `a\hb`, want: `a[\t ]b`, changes: 1},
+		{pattern: `(a)\1`, wantErr: `backreference \1`},
+		{pattern: `(?<n>a)\k<n>`, wantErr: `backreference \k`},
+		{pattern: `(a)\g1`, wantErr: `backreference \g`},
+		{pattern: `[\1]`, want: `[\1]`},
+
+		{pattern: `[a-z`, wantErr: "unterminated character class"},
+		{pattern: `[]a]+`, want: `[]a]+`},
+		{pattern: `[[:alpha:]]+`, want: `[[:alpha:]]+`},
+	}
+
+	for _, tt := range tests {
+		got, changes, err := rewritePCRE(tt.pattern)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("rewritePCRE(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("rewritePCRE(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("rewritePCRE(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+		if len(changes) != tt.changes {
+			t.Errorf("rewritePCRE(%q) made %d changes %q, want %d", tt.pattern, len(changes), changes, tt.changes)
+		}
+	}
+}
+
+func TestNegateSingleChar(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+		ok   bool
+	}{
+		{`x`, `[^x]`, true},
+		{`.`, ``, false},
+		{`\d`, `\D`, true},
+		{`\W`, `\w`, true},
+		{`\"`, `[^\"]`, true},
+		{`\b`, ``, false},
+		{`[abc]`, `[^abc]`, true},
+		{`[^abc]`, `[abc]`, true},
+		{`[a]b`, ``, false},
+		{`ab`, ``, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := negateSingleChar(tt.expr)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("negateSingleChar(%q) = %q, %v, want %q, %v", tt.expr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"secretsanta-cli/ruleset"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultRules names the built-in rules in --rules and extends
+const defaultRules = "default"
+
+// ruleLoader merges the rules of several rules files. A rule whose id was
+// defined by an earlier file overrides the fields it sets, or drops the rule
+// with disabled: true.
+type ruleLoader struct {
+	patterns []YamlPattern
+	index    map[string]int    // Position in patterns by rule id
+	sources  map[string]string // File that defined each rule id
+	loaded   map[string]bool   // Files already merged, so each is merged once
+}
+
+// readRules reads and merges the patterns of the rules sources in order: the
+// built-in rules ("default"), rules files or directories of *.yml and *.yaml
+// files. Without sources it returns the built-in rules.
+func readRules(sources []string) ([]YamlPattern, error) {
+	if len(sources) == 0 {
+		sources = []string{defaultRules}
+	}
+
+	l := &ruleLoader{
+		index:   make(map[string]int),
+		sources: make(map[string]string),
+		loaded:  make(map[string]bool),
+	}
+
+	for _, source := range sources {
+		files, err := rulesFiles(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if err := l.loadFile(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	patterns := make([]YamlPattern, 0, len(l.patterns))
+	for _, pattern := range l.patterns {
+		if !pattern.Disabled {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, nil
+}
+
+// rulesFiles returns the rules files of a source: the source itself, or the
+// *.yml and *.yaml files of a directory sorted by name
+func rulesFiles(source string) ([]string, error) {
+	if source == defaultRules {
+		return []string{source}, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, filepath.Join(source, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.yml or *.yaml rules files in %s", source)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadFile merges a rules file, after the file it extends
+func (l *ruleLoader) loadFile(file string) error {
+	key := file
+	if file != defaultRules {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		key = abs
+	}
+	if l.loaded[key] {
+		return nil
+	}
+	l.loaded[key] = true
+
+	var data []byte
+	if file == defaultRules {
+		data = ruleset.Default
+	} else {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	}
+
+	var config YamlConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parsing %s: %v", file, err)
+	}
+
+	if config.Extends != "" {
+		base := config.Extends
+		if base != defaultRules && !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(file), base)
+		}
+		if err := l.loadFile(base); err != nil {
+			return fmt.Errorf("%s extends %s: %v", file, config.Extends, err)
+		}
+	}
+
+	for _, entry := range config.Patterns {
+		if err := l.add(entry.Pattern, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a rule, or merges it into the rule with the same id from an earlier file
+func (l *ruleLoader) add(pattern YamlPattern, file string) error {
+	derived := pattern.ID == ""
+	if derived {
+		pattern.ID = ruleID(pattern.Name)
+	}
+
+	i, ok := l.index[pattern.ID]
+	if !ok {
+		if pattern.Disabled {
+			log.Printf("Warning: %s disables unknown rule %q", file, pattern.ID)
+		} else if pattern.Regex == "" {
+			return fmt.Errorf("%s: rule %q has no regex and overrides no rule", file, pattern.ID)
+		}
+
+		l.index[pattern.ID] = len(l.patterns)
+		l.sources[pattern.ID] = file
+		l.patterns = append(l.patterns, pattern)
+		return nil
+	}
+
+	if l.sources[pattern.ID] == file {
+		if !derived {
+			return fmt.Errorf("%s: rule id %q is defined twice", file, pattern.ID)
+		}
+		// Files without ids may reuse a name; keep both rules and leave
+		// the duplicate to rules test
+		log.Printf("Warning: %s has several rules named %q, give them ids", file, pattern.Name)
+		l.patterns = append(l.patterns, pattern)
+		return nil
+	}
+	l.sources[pattern.ID] = file
+	l.patterns[i].override(pattern)
+	return nil
+}
+
+// override sets the fields that o sets. Booleans can only be switched on.
+// A new regex also replaces the keywords and examples, which were written
+// for the old one.
+func (p *YamlPattern) override(o YamlPattern) {
+	if o.Regex != "" {
+		p.Regex = o.Regex
+		p.Keywords, p.Examples, p.CounterExamples = nil, nil, nil
+	}
+
+	setString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	setList := func(dst *[]string, src []string) {
+		if src != nil {
+			*dst = src
+		}
+	}
+
+	setString(&p.Name, o.Name)
+	setString(&p.Confidence, o.Confidence)
+	setString(&p.Description, o.Description)
+	setString(&p.Severity, o.Severity)
+	setString(&p.Remediation, o.Remediation)
+	setList(&p.Tags, o.Tags)
+	setList(&p.References, o.References)
+	setList(&p.Keywords, o.Keywords)
+	setList(&p.Examples, o.Examples)
+	setList(&p.CounterExamples, o.CounterExamples)
+	p.Multiline = p.Multiline || o.Multiline
+	p.Disabled = p.Disabled || o.Disabled
+}
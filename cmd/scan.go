@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of scan, set from the highest confidence among new findings
+const (
+	exitNoFindings   = 0
+	exitLowFindings  = 2
+	exitHighFindings = 3
+)
+
+// scanOptions holds the scan command's per-run options
+type scanOptions struct {
+	IncludeRemoved bool
+	FullHistory    bool     // Scan every commit, ignoring the scan state
+	RefScopes      []string // Refs whose history is scanned, see refScopePrefixes
+	Mode           string   // history or tree
+	SinceDate      string   // Shallow-clone new mirrors from this date, YYYY-MM-DD
+	Depth          int      // Shallow-clone new mirrors to this many commits per ref
+	MinConfidence  string
+	RulesTags      []string   // Only use rules with one of these tags
+	ExcludeTags    []string   // Skip rules with any of these tags
+	Allowlist      *allowlist // Global allowlist, merged with each repo's .secretsantaignore
+	BaselineFile   string
+	Baseline       *Baseline
+	Entropy        bool
+	EntropyLimits  map[string]string // Per-charset entropy thresholds
+	Verify         []string          // Providers whose credentials are verified
+	VerifyURLs     map[string]string // Base URL overrides by provider
+	VerifyRate     float64           // Verification requests per second and provider
+}
+
+var (
+	scanPaths []string
+	scanOpts  scanOptions
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Clone or update cached repositories and scan them for secrets",
+	Long: `Scan clones every non-archived repository listed in the repository cache
+(or updates it if it was cloned before) and scans the commits added since the
+previous run for secrets. New findings are appended to the report and saved
+to the findings file so the report can be regenerated later.
+
+Repositories are kept as bare mirrors in --repos-dir, e.g.
+repos/org-catalogfi/<name>.git, and updated with a git fetch that prunes the
+branches and tags deleted upstream; git must be installed. Clones with a
+worktree made by earlier versions are converted on the next scan.
+--since-date and --depth clone new repositories shallow, to save time and
+disk on large histories; only the fetched history is scanned.
+
+The scan state records the ref tips each repository was scanned up to, and
+the next run scans exactly the commits reachable from the current refs but
+not from those tips, so rebased, cherry-picked, back-dated and late-merged
+commits are scanned whatever their dates. Repositories that are new to the
+scan state get a full-history scan. --full-history scans every commit of
+every repository regardless of the state; "state reset --repo" does the same
+for a single repository on the next run. Findings already in the findings
+file aren't saved twice.
+
+Every --org and --user target has its own repository cache, scan state,
+findings file and report, named after the target, for example
+scan_state.org-catalogfi.json.
+
+With --path, GitHub is skipped entirely: each path is either a git repository
+or a directory of repositories, and their full history is scanned. No token,
+repository cache or scan state is needed, e.g. to check a checkout before
+pushing it.
+
+--refs selects the refs whose history is scanned: local branches, remote
+branches (remote-tracking, e.g. refs/remotes/origin/dev), tags, pull (the
+head of every GitHub pull request, which scan fetches only with this scope)
+and stash (the latest stash, e.g. of a --path checkout). The default is
+local,remote,tags. Every finding lists the refs its commit is reachable from.
+
+--mode tree scans the files present at each ref tip instead of the history,
+to show the secrets that are live in the code right now. A secret found in
+several refs is reported once, listing them all. Tree scans only write the
+report: they neither use nor update the scan state, and their findings aren't
+added to the findings file used by report and baseline. In both modes, every
+finding is marked as still present if the file at HEAD still has the secret,
+or as removed from HEAD.
+
+Only lines added by a commit are scanned. With --include-removed, removed
+lines are scanned as well and such findings are tagged as removed in that
+commit, so the report shows when a leaked secret was deleted.
+
+Every finding carries the confidence of the rule that matched it, and
+--min-confidence skips rules below the given level. Findings also carry the
+rule's id, severity, tags, description, remediation and references, and
+--rules-tag and --exclude-tag select rules by tag, e.g. --rules-tag cloud or
+--exclude-tag generic. The exit code reflects the highest confidence among
+new findings: 0 for none, 2 for low and 3 for high, so CI can fail on
+high-confidence leaks only.
+
+Findings can be suppressed by a .secretsantaignore file in the repository
+root, by the global allowlist file (--allowlist) or by a "secretsanta:allow"
+comment on the matching line. Allowlist rules match a secret fingerprint,
+a path glob, a pattern name or a commit:
+
+  fingerprint:sha256:3f1c...
+  path:test/fixtures/**
+  pattern:AWS client ID
+  commit:0a1b2c3d
+
+Suppressed findings are counted in the report summary, the json document and
+a summary line of the jsonl output, and listed with their reason in the csv
+and sarif outputs, but don't affect the exit code. With --baseline, findings
+recorded by "baseline create" or "baseline update" are treated the same way,
+so only new findings are reported.
+
+--entropy adds a detector for high-entropy base64 and hex tokens assigned to
+identifiers such as key, secret, token or password. It runs together with the
+regex rules, reports low-confidence findings tagged with their entropy, and
+its thresholds can be tuned per charset, e.g.
+--entropy-threshold base64=4.2,hex=3.2.
+
+--verify checks whether credentials found by the GitHub, Slack, AWS, Infura
+and Alchemy rules still work, by calling the provider's API (GitHub /user,
+Slack auth.test, STS GetCallerIdentity, eth_chainId). Verification is opt-in
+per provider, e.g. --verify github,slack or --verify all, and each finding is
+tagged verified: live, revoked or unknown. An AWS key ID is only checked when
+its secret key was found in the same file and commit. Requests are limited to
+--verify-rate per second and provider, and --verify-url points a provider at
+another endpoint, e.g. --verify-url github=http://127.0.0.1:8080.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if _, ok := confidenceLevels[scanOpts.MinConfidence]; !ok {
+			return fmt.Errorf("invalid --min-confidence %q, must be low or high", scanOpts.MinConfidence)
+		}
+		if err := validateRefScopes(scanOpts.RefScopes); err != nil {
+			return err
+		}
+		if scanOpts.SinceDate != "" {
+			if _, err := time.Parse("2006-01-02", scanOpts.SinceDate); err != nil {
+				return fmt.Errorf("invalid --since-date %q, use YYYY-MM-DD", scanOpts.SinceDate)
+			}
+		}
+		if scanOpts.Depth < 0 {
+			return fmt.Errorf("invalid --depth %d, must not be negative", scanOpts.Depth)
+		}
+		if !contains(scanModes, scanOpts.Mode) {
+			return fmt.Errorf("invalid --mode %q, must be one of %s", scanOpts.Mode, strings.Join(scanModes, ", "))
+		}
+
+		allow, err := loadAllowlistFile(cfg.AllowlistFile)
+		if err != nil {
+			return fmt.Errorf("loading allowlist: %v", err)
+		}
+		scanOpts.Allowlist = allow
+
+		if err := validateVerifyOptions(scanOpts.Verify, scanOpts.VerifyURLs); err != nil {
+			return err
+		}
+		if scanOpts.VerifyRate <= 0 {
+			return fmt.Errorf("invalid --verify-rate %v, must be positive", scanOpts.VerifyRate)
+		}
+
+		if scanOpts.BaselineFile != "" {
+			baseline, err := loadBaseline(scanOpts.BaselineFile)
+			if err != nil {
+				return fmt.Errorf("loading baseline: %v", err)
+			}
+			scanOpts.Baseline = baseline
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var findings []SecretMatch
+		if len(scanPaths) > 0 {
+			findings = runLocal(cfg, scanOpts, scanPaths)
+		} else {
+			findings = run(cfg, scanOpts)
+		}
+
+		active, _ := splitSuppressed(findings)
+		os.Exit(exitCodeFor(active))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.Flags().StringSliceVar(&scanPaths, "path", nil, "scan a local repository or directory of repositories instead of GitHub targets (repeatable)")
+	scanCmd.Flags().StringVar(&scanOpts.MinConfidence, "min-confidence", "low", "only use rules with at least this confidence (low or high)")
+	scanCmd.Flags().StringSliceVar(&scanOpts.RulesTags, "rules-tag", nil, "only use rules with one of these tags, e.g. cloud,crypto")
+	scanCmd.Flags().StringSliceVar(&scanOpts.ExcludeTags, "exclude-tag", nil, "skip rules with any of these tags")
+	scanCmd.Flags().StringVar(&scanOpts.BaselineFile, "baseline", "", "only report findings that aren't in this baseline file")
+	scanCmd.Flags().BoolVar(&scanOpts.Entropy, "entropy", false, "also detect high-entropy tokens assigned to key, secret, token or password identifiers")
+	scanCmd.Flags().StringToStringVar(&scanOpts.EntropyLimits, "entropy-threshold", nil, "minimum entropy in bits per character by charset (base64, hex)")
+	scanCmd.Flags().StringSliceVar(&scanOpts.Verify, "verify", nil, "verify found credentials against these providers: all, "+strings.Join(verifierProviders(), ", "))
+	scanCmd.Flags().StringToStringVar(&scanOpts.VerifyURLs, "verify-url", nil, "override a provider's API base URL, e.g. github=http://127.0.0.1:8080")
+	scanCmd.Flags().Float64Var(&scanOpts.VerifyRate, "verify-rate", 2, "maximum verification requests per second and provider")
+	scanCmd.Flags().StringVar(&scanOpts.Mode, "mode", scanModeHistory, "what to scan: history (the commits) or tree (the files at each ref tip)")
+	scanCmd.Flags().StringSliceVar(&scanOpts.RefScopes, "refs", defaultRefScopes, "refs to scan: "+strings.Join(refScopeNames(), ", "))
+	scanCmd.Flags().StringVar(&scanOpts.SinceDate, "since-date", "", "clone new repositories shallow, with the history since this date (YYYY-MM-DD)")
+	scanCmd.Flags().IntVar(&scanOpts.Depth, "depth", 0, "clone new repositories shallow, with this many commits of each ref")
+	scanCmd.Flags().BoolVar(&scanOpts.FullHistory, "full-history", false, "scan every commit of each repository instead of the commits added since the last scan")
+	scanCmd.Flags().BoolVar(&scanOpts.IncludeRemoved, "include-removed", false, "also scan removed lines and tag such findings as removed")
+}
+
+// exitCodeFor returns the exit code for the highest confidence in findings
+func exitCodeFor(findings []SecretMatch) int {
+	code := exitNoFindings
+	for _, match := range findings {
+		if confidenceLevels[match.Confidence] >= confidenceLevels["high"] {
+			return exitHighFindings
+		}
+		code = exitLowFindings
+	}
+	return code
+}
+
+// loadScanRules loads the patterns used by scan and attaches the optional detectors
+func loadScanRules(opts *Config, scanOpts scanOptions) *patternSet {
+	selection := ruleSelection{
+		MinConfidence: scanOpts.MinConfidence,
+		Tags:          scanOpts.RulesTags,
+		ExcludeTags:   scanOpts.ExcludeTags,
+	}
+
+	rules, err := loadPatterns(opts.Rules, selection)
+	if err != nil {
+		log.Fatalf("Error loading patterns: %v", err)
+	}
+	if len(rules.patterns)+len(rules.multiline) == 0 {
+		log.Fatal("No rules left after applying --min-confidence, --rules-tag and --exclude-tag")
+	}
+
+	if scanOpts.Entropy {
+		// Entropy findings are low confidence and tagged generic and entropy
+		if !selection.includes(entropyRules[charsetBase64].YamlPattern) {
+			log.Printf("Warning: --entropy has no effect with the selected confidence and tags")
+			return rules
+		}
+
+		rules.entropy, err = newEntropyDetector(scanOpts.EntropyLimits)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return rules
+}
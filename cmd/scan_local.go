@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+// findLocalRepos resolves paths to git repositories. A path is either a
+// repository itself or a directory whose immediate subdirectories are repositories.
+func findLocalRepos(paths []string) ([]RepoInfo, error) {
+	var repoInfos []RepoInfo
+	seen := make(map[string]bool)
+
+	add := func(dir string) {
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		repoInfos = append(repoInfos, RepoInfo{
+			URL:      dir,
+			LocalDir: dir,
+		})
+	}
+
+	for _, path := range paths {
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %v", path, err)
+		}
+
+		if _, err := git.PlainOpen(dir); err == nil {
+			add(dir)
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+
+		found := false
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			sub := filepath.Join(dir, entry.Name())
+			if _, err := git.PlainOpen(sub); err == nil {
+				add(sub)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%s is not a git repository and contains none", path)
+		}
+	}
+
+	return repoInfos, nil
+}
+
+// runLocal scans the full history of repositories on disk, without
+// touching GitHub, the repository cache or the scan state
+func runLocal(opts *Config, scanOpts scanOptions, paths []string) []SecretMatch {
+	// Initialize count
+	count = 0
+
+	repoInfos, err := findLocalRepos(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rules := loadScanRules(opts, scanOpts)
+
+	// Local checkouts are scanned from their first commit
+	startFor := func(RepoInfo) scanStart { return scanStart{} }
+
+	allFindings, _ := scanRepos(repoInfos, opts.Concurrency, startFor, scanOpts, rules)
+
+	if len(scanOpts.Verify) > 0 {
+		allFindings = verifyFindings(allFindings, scanOpts)
+	}
+
+	// Write findings to report
+	if err := writeScanOutput(opts.Format, opts.OutputFile, allFindings); err != nil {
+		log.Printf("Error writing report: %v", err)
+	} else {
+		log.Printf("Updated findings in %s", opts.OutputFile)
+	}
+
+	active, suppressed := splitSuppressed(allFindings)
+	fmt.Printf("Scanned %d repositories, found %d potential secrets (%d suppressed)\n", count, len(active), len(suppressed))
+	fmt.Println("Scanning complete.")
+
+	return allFindings
+}
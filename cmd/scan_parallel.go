@@ -3,33 +3,35 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"secretsanta-cli/local"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/joho/godotenv"
 	git "gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 
 	"github.com/google/go-github/v48/github"
-	"gopkg.in/yaml.v2"
 )
 
-// Constants for controlling resource usage
+// Default settings, overridable through the config file, environment or flags
 const (
-	scanConcurrency = 4                 // @note you can change this value depending on the no. of threads you want to run concurrently
-	reposDir        = "./repos"         // Persistent directory for repositories
-	stateFile       = "scan_state.json" // File to track last run
-	outputFile      = "secrets_report.md"
-	scanIntervalStr = "168h" // 7 days (1 week) between scans
+	scanConcurrency = 4                   // @note you can change this value depending on the no. of threads you want to run concurrently
+	reposDir        = "./repos"           // Persistent directory for repositories
+	stateFile       = "scan_state.json"   // File to track last run
+	outputFile      = "secrets_report.md" // Markdown report
+	reposCache      = "cached_repos.json" // Repositories fetched by fetch-repos
+	findingsFile    = "findings.json"     // Findings accumulated across runs
 )
 
 // SecretIdentifier uniquely identifies a secret within repos
@@ -37,29 +39,76 @@ type SecretIdentifier struct {
 	FilePath    string
 	Secret      string
 	PatternName string
+	Removed     bool
 }
 
-// SecretMatch represents a secret found in a commit
+// SecretMatch represents a secret found in a commit. The JSON field names are
+// part of the findings schema, see findingsSchemaVersion.
 type SecretMatch struct {
-	Commit      *object.Commit
-	PatternName string
-	Secret      string
-	FilePath    string
-	RepoURL     string
-	Found       time.Time
+	CommitHash  string    `json:"commit"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	Date        time.Time `json:"date"`
+	CommitTime  time.Time `json:"commit_time"`
+	PatternName string    `json:"pattern"`
+	Confidence  string    `json:"confidence"`
+	RuleID      string    `json:"rule_id,omitempty"`
+	Severity    string    `json:"severity,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Remediation string    `json:"remediation,omitempty"`
+	References  []string  `json:"references,omitempty"`
+	Secret      string    `json:"secret"`
+	Fingerprint string    `json:"fingerprint"`
+	FilePath    string    `json:"file"`
+	Line        int       `json:"line"`
+	EndLine     int       `json:"end_line,omitempty"` // Last line of a multi-line secret
+	Column      int       `json:"column"`
+	EndColumn   int       `json:"end_column,omitempty"`    // Column just past the secret on its last line
+	Removed     bool      `json:"removed,omitempty"`       // The commit removed the secret rather than adding it
+	ParentHash  string    `json:"parent_commit,omitempty"` // For removed secrets, the commit whose blob Line refers to
+	Suppressed  string    `json:"suppressed,omitempty"`    // Why an allowlist rule suppressed the finding
+	Entropy     float64   `json:"entropy,omitempty"`       // Shannon entropy, for findings of the entropy detector
+	Verified    string    `json:"verified,omitempty"`      // live, revoked or unknown, set by scan --verify
+	Refs        []string  `json:"refs,omitempty"`          // Refs the commit is reachable from
+	HeadStatus  string    `json:"head_status,omitempty"`   // present or removed: whether the file at HEAD still has the secret
+	RepoURL     string    `json:"repository"`
+	Found       time.Time `json:"found"`
 }
 
-// ScanState tracks the state of scanning between runs
+// ScanState tracks the state of scanning between runs. A repository's next
+// scan covers the commits reachable from its refs but not from the tips
+// recorded here, whatever their dates. Repositories recorded by an older
+// version fall back to a time cutoff, new ones get a full-history scan.
 type ScanState struct {
-	LastRun        time.Time            `json:"last_run"`
-	RepoLastCommit map[string]time.Time `json:"repo_last_commit"`
+	LastRun        time.Time                    `json:"last_run"`
+	RepoLastCommit map[string]time.Time         `json:"repo_last_commit,omitempty"` // Cutoff for repositories without tips
+	RepoTips       map[string]map[string]string `json:"repo_tips"`                  // Scanned commit by ref name, by repository URL
 }
 
 // YamlPattern defines the structure for a secret detection pattern
 type YamlPattern struct {
+	ID         string `yaml:"id"` // Stable identifier; derived from the name if empty
 	Name       string `yaml:"name"`
 	Regex      string `yaml:"regex"`
 	Confidence string `yaml:"confidence"`
+	Multiline  bool   `yaml:"multiline"` // Match against whole hunks or blobs instead of single lines
+	Disabled   bool   `yaml:"disabled"`  // Drops a rule defined by an earlier rules file
+
+	// Metadata copied into findings
+	Description string   `yaml:"description"`
+	Severity    string   `yaml:"severity"` // low, medium, high or critical
+	Tags        []string `yaml:"tags"`     // e.g. crypto, cloud, saas; --rules-tag selects rules by tag
+	Remediation string   `yaml:"remediation"`
+	References  []string `yaml:"references"`
+
+	// Only run the rule on text containing one of these, case-insensitively.
+	// Without keywords they are extracted from the regex where possible.
+	Keywords []string `yaml:"keywords"`
+
+	// Checked by rules test
+	Examples        []string `yaml:"examples"`         // Text the rule must match
+	CounterExamples []string `yaml:"counter_examples"` // Text the rule must not match
 }
 
 // YamlEntry wraps a pattern
@@ -69,6 +118,7 @@ type YamlEntry struct {
 
 // YamlConfig is the root structure for the rules config
 type YamlConfig struct {
+	Extends  string      `yaml:"extends"` // "default" or a rules file loaded before this one
 	Patterns []YamlEntry `yaml:"patterns"`
 }
 
@@ -76,29 +126,93 @@ type YamlConfig struct {
 var count int
 
 // loadState loads the previous scan state from the state file
-func loadState() (*ScanState, error) {
+func loadState(stateFile string) (*ScanState, error) {
 	data, err := os.ReadFile(stateFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File doesn't exist, return default state
-			return &ScanState{
-				LastRun:        time.Now().Add(-168 * time.Hour),
-				RepoLastCommit: make(map[string]time.Time),
-			}, nil
+			return newScanState(time.Time{}), nil
 		}
 		return nil, err
 	}
 
-	var state ScanState
-	if err := json.Unmarshal(data, &state); err != nil {
+	state := newScanState(time.Time{})
+	if err := json.Unmarshal(data, state); err != nil {
 		return nil, err
 	}
+	if state.RepoLastCommit == nil {
+		state.RepoLastCommit = make(map[string]time.Time)
+	}
+	if state.RepoTips == nil {
+		state.RepoTips = make(map[string]map[string]string)
+	}
+
+	return state, nil
+}
+
+// newScanState returns a state without scanned repositories
+func newScanState(lastRun time.Time) *ScanState {
+	return &ScanState{
+		LastRun:        lastRun,
+		RepoLastCommit: make(map[string]time.Time),
+		RepoTips:       make(map[string]map[string]string),
+	}
+}
+
+// startFor returns where the next scan of a repository starts; the zero
+// start for a repository the state doesn't know yet
+func (s *ScanState) startFor(repoURL string) scanStart {
+	if tips, ok := s.RepoTips[repoURL]; ok {
+		return scanStart{Tips: tips}
+	}
+	if cutoff, ok := s.RepoLastCommit[repoURL]; ok {
+		return scanStart{Since: cutoff}
+	}
+	return scanStart{}
+}
+
+// reset forgets a repository, so its next scan covers its full history. It
+// reports whether the state knew the repository.
+func (s *ScanState) reset(repoURL string) bool {
+	_, hasTips := s.RepoTips[repoURL]
+	_, hasCutoff := s.RepoLastCommit[repoURL]
+	delete(s.RepoTips, repoURL)
+	delete(s.RepoLastCommit, repoURL)
+	return hasTips || hasCutoff
+}
+
+// record stores where the next scan of a repository starts
+func (s *ScanState) record(repoURL string, start scanStart) {
+	if start.Tips != nil {
+		s.RepoTips[repoURL] = start.Tips
+		delete(s.RepoLastCommit, repoURL)
+		return
+	}
+	s.RepoLastCommit[repoURL] = start.Since
+}
+
+// scanStart says which commits of a repository are new: those not reachable
+// from Tips or, without tips, those committed after Since. The zero value
+// scans the full history.
+type scanStart struct {
+	Tips  map[string]string // Commit hash by ref name
+	Since time.Time
+}
 
-	return &state, nil
+// String describes the start for progress messages
+func (s scanStart) String() string {
+	switch {
+	case s.Tips != nil:
+		return "new commits since the last scan"
+	case s.Since.IsZero():
+		return "full history"
+	default:
+		return "changes since " + s.Since.Format("2006-01-02 15:04:05")
+	}
 }
 
 // saveState saves the current scan state to the state file
-func saveState(state *ScanState) error {
+func saveState(stateFile string, state *ScanState) error {
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
@@ -107,65 +221,316 @@ func saveState(state *ScanState) error {
 	return os.WriteFile(stateFile, data, 0644)
 }
 
-// loadPatterns loads secret detection patterns from the rules file
-func loadPatterns(yamlFile string) ([]*regexp.Regexp, map[*regexp.Regexp]string, error) {
-	data, err := os.ReadFile(yamlFile)
-	if err != nil {
-		return nil, nil, err
+// confidenceLevels ranks the confidence values used in the rules file
+var confidenceLevels = map[string]int{
+	"low":  1,
+	"high": 2,
+}
+
+// severityLevels ranks the severity values used in the rules file
+var severityLevels = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// rule is a compiled pattern together with its metadata
+type rule struct {
+	YamlPattern
+	re *regexp.Regexp
+}
+
+// ruleSelection picks the rules of the rules file a run uses
+type ruleSelection struct {
+	MinConfidence string   // Skip rules below this confidence, unless empty
+	Tags          []string // Only use rules with one of these tags, unless empty
+	ExcludeTags   []string // Skip rules with any of these tags
+}
+
+// includes reports whether a rule is selected
+func (s ruleSelection) includes(pattern YamlPattern) bool {
+	if s.MinConfidence != "" && confidenceLevels[pattern.Confidence] < confidenceLevels[s.MinConfidence] {
+		return false
+	}
+	for _, tag := range pattern.Tags {
+		if contains(s.ExcludeTags, tag) {
+			return false
+		}
+	}
+	if len(s.Tags) == 0 {
+		return true
 	}
+	for _, tag := range pattern.Tags {
+		if contains(s.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternSet holds the compiled rules used by a scan
+type patternSet struct {
+	patterns  []*rule
+	multiline []*rule          // Run against whole hunks or blobs rather than lines
+	entropy   *entropyDetector // Optional, runs next to the regex patterns
 
-	var config YamlConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, nil, err
+	// Keyword prefilters for patterns and multiline; nil runs every pattern
+	filter          *prefilter
+	multilineFilter *prefilter
+}
+
+// candidates returns the patterns, or multiline patterns, worth running on text
+func (r *patternSet) candidates(text string, multiline bool) []*rule {
+	patterns, filter := r.patterns, r.filter
+	if multiline {
+		patterns, filter = r.multiline, r.multilineFilter
+	}
+	if filter == nil {
+		return patterns
 	}
 
-	var patterns []*regexp.Regexp
-	patternNames := make(map[*regexp.Regexp]string)
+	indices := filter.candidates(text)
+	selected := make([]*rule, len(indices))
+	for i, index := range indices {
+		selected[i] = patterns[index]
+	}
+	return selected
+}
 
-	for _, entry := range config.Patterns {
-		pattern := entry.Pattern.Regex
+// loadPatterns loads the secret detection patterns of the rules sources that
+// selection includes
+func loadPatterns(sources []string, selection ruleSelection) (*patternSet, error) {
+	patterns, err := readRules(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &patternSet{}
+	var keywords, multilineKeywords [][]string
 
-		// Clean up regex format if needed
-		if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
-			pattern = pattern[1 : len(pattern)-1]
+	for _, pattern := range patterns {
+		if !selection.includes(pattern) {
+			continue
 		}
 
-		re, err := regexp.Compile(pattern)
+		compiled, err := compileRule(pattern.Regex, pattern.Multiline)
 		if err != nil {
-			log.Printf("Warning: Invalid regex '%s' for pattern '%s': %v", pattern, entry.Pattern.Name, err)
+			log.Printf("Warning: Skipping pattern '%s': %v (see rules lint)", pattern.Name, err)
 			continue
 		}
 
-		patterns = append(patterns, re)
-		patternNames[re] = entry.Pattern.Name
+		r := &rule{YamlPattern: pattern, re: compiled.re}
+		if pattern.Multiline {
+			rules.multiline = append(rules.multiline, r)
+			multilineKeywords = append(multilineKeywords, ruleKeywords(pattern, r.re))
+		} else {
+			rules.patterns = append(rules.patterns, r)
+			keywords = append(keywords, ruleKeywords(pattern, r.re))
+		}
 	}
 
-	return patterns, patternNames, nil
+	rules.filter = newPrefilter(keywords)
+	rules.multilineFilter = newPrefilter(multilineKeywords)
+
+	return rules, nil
+}
+
+// secretHit is a single pattern match within scanned text
+type secretHit struct {
+	Secret     string
+	Rule       *rule
+	FilePath   string
+	Line       int     // 1-based line number
+	EndLine    int     // Last line of a multi-line hit, 0 for single-line hits
+	Column     int     // 1-based byte offset within the line
+	Removed    bool    // Found on a removed line; Line refers to the parent blob
+	Suppressed string  // Set when the line carries an inline allow marker
+	Entropy    float64 // Shannon entropy, for hits of the entropy detector
 }
 
-// scanDiffForSecrets looks for secrets in diff text using regex patterns
-func scanDiffForSecrets(diff string, patterns []*regexp.Regexp, patternNames map[*regexp.Regexp]string) map[string]string {
-	secretsWithPatterns := make(map[string]string)
+// shift moves a hit down by lines, e.g. from hunk-relative to blob line numbers
+func (h *secretHit) shift(lines int) {
+	h.Line += lines
+	if h.EndLine > 0 {
+		h.EndLine += lines
+	}
+}
+
+// maxSecretLength is the longest single-line secret reported; longer matches
+// are almost always minified code or data rather than credentials
+const maxSecretLength = 500
+
+// tooLong reports whether a hit is too long to be a real secret. Multi-line
+// rules match whole keys, such as PEM blocks, which are longer by nature.
+func (h *secretHit) tooLong() bool {
+	return !h.Rule.Multiline && len(h.Secret) > maxSecretLength
+}
+
+// endColumn returns the column just past the secret on its last line
+func (h *secretHit) endColumn() int {
+	if i := strings.LastIndex(h.Secret, "\n"); i >= 0 {
+		return len(h.Secret) - i
+	}
+	return h.Column + len(h.Secret)
+}
+
+// scanDiffForSecrets looks for secrets in text using regex patterns, line by
+// line, and with multi-line patterns over the whole text. Line numbers of the
+// hits are relative to the first line of text.
+func scanDiffForSecrets(diff string, rules *patternSet) []secretHit {
+	var hits []secretHit
 
 	lines := strings.Split(diff, "\n")
-	for _, line := range lines {
-		for _, pattern := range patterns {
-			found := pattern.FindAllString(line, -1)
-			if len(found) > 0 {
-				for _, match := range found {
-					secretsWithPatterns[match] = patternNames[pattern]
+	for i, line := range lines {
+		suppressed := ""
+		if strings.Contains(line, inlineAllowMarker) {
+			suppressed = suppressedInline
+		}
+
+		for _, r := range rules.candidates(line, false) {
+			for _, loc := range r.re.FindAllStringIndex(line, -1) {
+				hits = append(hits, secretHit{
+					Secret:     line[loc[0]:loc[1]],
+					Rule:       r,
+					Line:       i + 1,
+					Column:     loc[0] + 1,
+					Suppressed: suppressed,
+				})
+			}
+		}
+
+		if rules.entropy != nil {
+			for _, hit := range rules.entropy.scanLine(line) {
+				hit.Line = i + 1
+				hit.Suppressed = suppressed
+				hits = append(hits, hit)
+			}
+		}
+	}
+
+	for _, r := range rules.candidates(diff, true) {
+		for _, loc := range r.re.FindAllStringIndex(diff, -1) {
+			secret := diff[loc[0]:loc[1]]
+			line := strings.Count(diff[:loc[0]], "\n") + 1
+
+			suppressed := ""
+			if strings.Contains(lines[line-1], inlineAllowMarker) || strings.Contains(secret, inlineAllowMarker) {
+				suppressed = suppressedInline
+			}
+
+			hits = append(hits, secretHit{
+				Secret:     secret,
+				Rule:       r,
+				Line:       line,
+				EndLine:    line + strings.Count(strings.TrimSuffix(secret, "\n"), "\n"),
+				Column:     loc[0] - (strings.LastIndex(diff[:loc[0]], "\n") + 1) + 1,
+				Suppressed: suppressed,
+			})
+		}
+	}
+
+	return hits
+}
+
+// scanCommitForSecrets scans the lines a commit adds, file patch by file patch
+// and hunk by hunk, so each hit carries its own file and its line in the new
+// blob. With opts.IncludeRemoved, removed lines are scanned too and their hits
+// point into the parent's blob. Root commits, or commits whose parent can't be
+// read, are scanned as full file contents.
+func scanCommitForSecrets(c *object.Commit, opts scanOptions, rules *patternSet) []secretHit {
+	var hits []secretHit
+
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err == nil {
+			patch, err := parent.Patch(c)
+			if err != nil {
+				return nil
+			}
+
+			for _, filePatch := range patch.FilePatches() {
+				if filePatch.IsBinary() {
+					continue
+				}
+
+				from, to := filePatch.Files()
+
+				// Line numbers in the old and new blob where the next chunk starts
+				oldLine, newLine := 1, 1
+				for _, chunk := range filePatch.Chunks() {
+					content := chunk.Content()
+					switch chunk.Type() {
+					case diff.Add:
+						for _, hit := range scanDiffForSecrets(content, rules) {
+							hit.FilePath = to.Path()
+							hit.shift(newLine - 1)
+							hits = append(hits, hit)
+						}
+						newLine += countLines(content)
+					case diff.Delete:
+						if opts.IncludeRemoved {
+							for _, hit := range scanDiffForSecrets(content, rules) {
+								hit.FilePath = from.Path()
+								hit.shift(oldLine - 1)
+								hit.Removed = true
+								hits = append(hits, hit)
+							}
+						}
+						oldLine += countLines(content)
+					case diff.Equal:
+						oldLine += countLines(content)
+						newLine += countLines(content)
+					}
 				}
 			}
+
+			return hits
 		}
 	}
 
-	return secretsWithPatterns
+	// Initial commit - scan the full content of every file
+	tree, err := c.Tree()
+	if err != nil {
+		return nil
+	}
+
+	tree.Files().ForEach(func(f *object.File) error {
+		hits = append(hits, scanFileForSecrets(f, rules)...)
+		return nil
+	})
+
+	return hits
+}
+
+// scanFileForSecrets scans the full content of a file, skipping binary files
+func scanFileForSecrets(f *object.File, rules *patternSet) []secretHit {
+	if isBinary, err := f.IsBinary(); err != nil || isBinary {
+		return nil
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil
+	}
+
+	hits := scanDiffForSecrets(content, rules)
+	for i := range hits {
+		hits[i].FilePath = f.Name
+	}
+	return hits
 }
 
-const reposCache = "cached_repos.json"
+// countLines returns the number of lines in a diff chunk
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+}
 
 // FetchCachedRepos reads repositories from the cache file
-func FetchCachedRepos() ([]*github.Repository, error) {
+func FetchCachedRepos(reposCache string) ([]*github.Repository, error) {
 	data, err := os.ReadFile(reposCache)
 	if err != nil {
 		return nil, fmt.Errorf("error reading cache file: %v", err)
@@ -180,11 +545,12 @@ func FetchCachedRepos() ([]*github.Repository, error) {
 	return repos, nil
 }
 
-// appendToReport adds new findings to the existing report file
-func appendToReport(findings []SecretMatch) error {
+// appendToReport adds new findings to the existing report file, with a count
+// of the suppressed ones
+func appendToReport(outputFile string, findings, suppressed []SecretMatch) error {
 	// Create report file if it doesn't exist
 	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
-		f, err := os.Create(outputFile)
+		f, err := openPrivate(outputFile, os.O_CREATE|os.O_WRONLY)
 		if err != nil {
 			return err
 		}
@@ -196,12 +562,12 @@ func appendToReport(findings []SecretMatch) error {
 	}
 
 	// If no findings, nothing to do
-	if len(findings) == 0 {
+	if len(findings) == 0 && len(suppressed) == 0 {
 		return nil
 	}
 
 	// Open file for appending
-	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_WRONLY, 0644)
+	f, err := openPrivate(outputFile, os.O_APPEND|os.O_WRONLY)
 	if err != nil {
 		return err
 	}
@@ -213,6 +579,25 @@ func appendToReport(findings []SecretMatch) error {
 		return err
 	}
 
+	if err := writeSuppressedNote(f, suppressed); err != nil {
+		return err
+	}
+
+	return writeFindings(f, findings)
+}
+
+// writeSuppressedNote notes how many findings the allowlists suppressed
+func writeSuppressedNote(w io.Writer, suppressed []SecretMatch) error {
+	if len(suppressed) == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "Suppressed findings: %s\n\n", suppressedSummary(suppressed))
+	return err
+}
+
+// writeFindings writes findings grouped by repository as Markdown
+func writeFindings(w io.Writer, findings []SecretMatch) error {
 	// Group findings by repository
 	repoFindings := make(map[string][]SecretMatch)
 	for _, match := range findings {
@@ -220,51 +605,171 @@ func appendToReport(findings []SecretMatch) error {
 		repoFindings[repoURL] = append(repoFindings[repoURL], match)
 	}
 
-	// Write each repository's findings
-	for repoURL, matches := range repoFindings {
-		_, err = f.WriteString(fmt.Sprintf("### Repository: %s\n\n", repoURL))
+	// Index removals so added secrets can show when they were deleted
+	removals := make(map[string]SecretMatch)
+	for _, match := range findings {
+		if match.Removed {
+			removals[removalKey(match)] = match
+		}
+	}
+
+	repoURLs := make([]string, 0, len(repoFindings))
+	for repoURL := range repoFindings {
+		repoURLs = append(repoURLs, repoURL)
+	}
+	sort.Strings(repoURLs)
+
+	// Write each repository's findings, highest confidence first
+	for _, repoURL := range repoURLs {
+		matches := repoFindings[repoURL]
+		sortFindings(matches)
+
+		_, err := fmt.Fprintf(w, "### Repository: %s\n\n", repoURL)
 		if err != nil {
 			return err
 		}
 
-		for _, match := range matches {
+		confidence := ""
+		for i, match := range matches {
+			// Start a new group whenever the confidence changes
+			if i == 0 || match.Confidence != confidence {
+				confidence = match.Confidence
+				_, err = fmt.Fprintf(w, "#### %s confidence\n\n", confidenceTitle(confidence))
+				if err != nil {
+					return err
+				}
+			}
+
 			// Truncate very long secrets
 			secretDisplay := match.Secret
 			if len(secretDisplay) > 100 {
 				secretDisplay = secretDisplay[:97] + "..."
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("#### %s\n\n", match.PatternName))
+			title := match.PatternName
+			if match.Removed {
+				title += " (removed)"
+			}
+
+			_, err = fmt.Fprintf(w, "##### %s\n\n", title)
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("- **File:** %s\n", match.FilePath))
+			if match.RuleID != "" {
+				_, err = fmt.Fprintf(w, "- **Rule:** `%s`%s\n", match.RuleID, ruleDetails(match))
+				if err != nil {
+					return err
+				}
+			}
+
+			if match.Description != "" {
+				_, err = fmt.Fprintf(w, "- **Description:** %s\n", match.Description)
+				if err != nil {
+					return err
+				}
+			}
+
+			if match.EndLine > match.Line {
+				_, err = fmt.Fprintf(w, "- **File:** %s (lines %d-%d, column %d)\n", match.FilePath, match.Line, match.EndLine, match.Column)
+			} else {
+				_, err = fmt.Fprintf(w, "- **File:** %s (line %d, column %d)\n", match.FilePath, match.Line, match.Column)
+			}
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("- **Commit:** `%s`\n", match.Commit.Hash.String()))
+			// Removed lines only exist in the parent's blob
+			linkCommit := match.CommitHash
+			if match.Removed {
+				linkCommit = match.ParentHash
+			}
+
+			if link := blobURL(match.RepoURL, linkCommit, match.FilePath, match.Line); link != "" {
+				_, err = fmt.Fprintf(w, "- **Link:** %s\n", link)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = fmt.Fprintf(w, "- **Commit:** `%s`\n", match.CommitHash)
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("- **Author:** %s <%s>\n", match.Commit.Author.Name, match.Commit.Author.Email))
+			_, err = fmt.Fprintf(w, "- **Author:** %s <%s>\n", match.Author, match.AuthorEmail)
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("- **Date:** %s\n", match.Commit.Author.When.Format("2006-01-02 15:04:05")))
+			_, err = fmt.Fprintf(w, "- **Date:** %s\n", match.Date.Format("2006-01-02 15:04:05"))
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString(fmt.Sprintf("- **Value:** `%s`\n\n", secretDisplay))
+			if match.Removed {
+				_, err = fmt.Fprintf(w, "- **Status:** removed in commit `%s`\n", match.CommitHash)
+				if err != nil {
+					return err
+				}
+			} else if removal, ok := removals[removalKey(match)]; ok {
+				_, err = fmt.Fprintf(w, "- **Status:** removed in commit `%s` on %s\n", removal.CommitHash, removal.Date.Format("2006-01-02 15:04:05"))
+				if err != nil {
+					return err
+				}
+			}
+
+			switch match.HeadStatus {
+			case headPresent:
+				_, err = fmt.Fprintf(w, "- **HEAD:** still present in %s\n", match.FilePath)
+			case headRemoved:
+				_, err = fmt.Fprintf(w, "- **HEAD:** removed from %s\n", match.FilePath)
+			}
 			if err != nil {
 				return err
 			}
 
-			_, err = f.WriteString("---\n\n")
+			if len(match.Refs) > 0 {
+				_, err = fmt.Fprintf(w, "- **Refs:** %s\n", strings.Join(match.Refs, ", "))
+				if err != nil {
+					return err
+				}
+			}
+
+			if match.Verified != "" {
+				_, err = fmt.Fprintf(w, "- **Verified:** %s\n", match.Verified)
+				if err != nil {
+					return err
+				}
+			}
+
+			if match.Entropy > 0 {
+				_, err = fmt.Fprintf(w, "- **Entropy:** %.2f bits per character\n", match.Entropy)
+				if err != nil {
+					return err
+				}
+			}
+
+			if match.Remediation != "" {
+				_, err = fmt.Fprintf(w, "- **Remediation:** %s\n", match.Remediation)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(match.References) > 0 {
+				_, err = fmt.Fprintf(w, "- **References:** %s\n", strings.Join(match.References, ", "))
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = fmt.Fprintf(w, "- **Value:** `%s`\n\n", secretDisplay)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.WriteString(w, "---\n\n")
 			if err != nil {
 				return err
 			}
@@ -274,245 +779,267 @@ func appendToReport(findings []SecretMatch) error {
 	return nil
 }
 
-func scanRepoForSecrets(repoPath, repoURL string, since time.Time, patterns []*regexp.Regexp, patternNames map[*regexp.Regexp]string, resultsCh chan<- SecretMatch) (time.Time, error) {
+// sortFindings orders findings by descending confidence, then by pattern,
+// file and line
+func sortFindings(findings []SecretMatch) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if ca, cb := confidenceLevels[a.Confidence], confidenceLevels[b.Confidence]; ca != cb {
+			return ca > cb
+		}
+		if a.PatternName != b.PatternName {
+			return a.PatternName < b.PatternName
+		}
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.Line < b.Line
+	})
+}
+
+// ruleDetails describes a finding's severity and tags, e.g. " (severity high; tags cloud)"
+func ruleDetails(match SecretMatch) string {
+	var details []string
+	if match.Severity != "" {
+		details = append(details, "severity "+match.Severity)
+	}
+	if len(match.Tags) > 0 {
+		details = append(details, "tags "+strings.Join(match.Tags, ", "))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, "; ") + ")"
+}
+
+// confidenceTitle capitalizes a confidence level for headings
+func confidenceTitle(confidence string) string {
+	if confidence == "" {
+		return "Unknown"
+	}
+	return strings.ToUpper(confidence[:1]) + confidence[1:]
+}
+
+// removalKey matches a removed secret with the finding that added it. It uses
+// the fingerprint, as the secret itself may already be redacted.
+func removalKey(match SecretMatch) string {
+	return strings.Join([]string{match.RepoURL, match.FilePath, match.PatternName, findingFingerprint(match)}, "\x00")
+}
+
+// scanRepoForSecrets scans the new commits of a repository, as given by
+// start, or with --mode tree the files at its ref tips, and returns the tips
+// of the refs it scanned
+func scanRepoForSecrets(repoPath, repoURL string, start scanStart, opts scanOptions, rules *patternSet, resultsCh chan<- SecretMatch) (map[string]string, error) {
 	repo, err := git.PlainOpen(repoPath)
 	if err != nil {
-		return since, fmt.Errorf("opening repository: %v", err)
+		return nil, fmt.Errorf("opening repository: %v", err)
 	}
 
-	// Get all branches
-	branches, err := repo.Branches()
+	// The repository's own .secretsantaignore applies on top of the global allowlist
+	repoAllow, err := loadRepoAllowlist(repo, repoPath)
 	if err != nil {
-		return since, fmt.Errorf("getting branches: %v", err)
+		log.Printf("Warning: ignoring invalid %s in %s: %v", ignoreFileName, repoURL, err)
 	}
+	allow := opts.Allowlist.merge(repoAllow)
 
-	// Map to track all commits by hash (to avoid duplicates)
-	scanned := make(map[string]bool)
-	oldestCommits := make(map[SecretIdentifier]*SecretMatch)
+	tips, err := refTips(repo, opts.RefScopes)
+	if err != nil {
+		return nil, err
+	}
 
-	// Track latest commit time
-	var latestCommitTime time.Time
+	var matches []*SecretMatch
+	if opts.Mode == scanModeTree {
+		matches, err = scanTreesForSecrets(repo, repoURL, tips, opts, rules, allow)
+	} else {
+		matches, err = scanHistoryForSecrets(repo, repoURL, start, tips, opts, rules, allow)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Process each branch
-	err = branches.ForEach(func(ref *plumbing.Reference) error {
-		commitIter, err := repo.Log(&git.LogOptions{
-			From:  ref.Hash(),
-			Order: git.LogOrderCommitterTime,
-		})
-		if err != nil {
-			return fmt.Errorf("getting commit log: %v", err)
-		}
-		defer commitIter.Close()
+	markHeadStatus(repo, matches)
 
-		// Process commits in this branch
-		err = commitIter.ForEach(func(c *object.Commit) error {
-			// Only process newer commits
-			if c.Committer.When.Before(since) || c.Committer.When.Equal(since) {
-				return nil
-			}
+	// Send all secrets found
+	for _, match := range matches {
+		resultsCh <- *match
+	}
 
-			// Update latest commit time if this is newer
-			if c.Committer.When.After(latestCommitTime) {
-				latestCommitTime = c.Committer.When
-			}
+	// Force garbage collection to clean up memory
+	matches = nil
+	runtime.GC()
 
-			// Skip already processed commits
-			if scanned[c.Hash.String()] {
-				return nil
-			}
-			scanned[c.Hash.String()] = true
+	return tips, nil
+}
 
-			// Process commits regardless of whether they have parents
-			var diffText string
+// scanHistoryForSecrets scans the commits reachable from tips that start
+// says are new, and returns the oldest commit that added (or removed) each
+// secret
+func scanHistoryForSecrets(repo *git.Repository, repoURL string, start scanStart, tips map[string]string, opts scanOptions, rules *patternSet, allow *allowlist) ([]*SecretMatch, error) {
+	// Commits reachable from the previous tips were scanned before. Commits
+	// scanned in this run are added too, so shared history is walked once.
+	scanned, err := reachableCommits(repo, start.Tips)
+	if err != nil {
+		return nil, err
+	}
+	missing := shallowParents(repo)
+	oldestCommits := make(map[SecretIdentifier]*SecretMatch)
+	children := make(map[plumbing.Hash][]plumbing.Hash)
 
-			if c.NumParents() > 0 {
-				// Normal commit with parent
-				parent, err := c.Parent(0)
-				if err != nil {
-					// Try to get content directly if we can't get the parent
-					tree, err := c.Tree()
-					if err == nil {
-						var allFileContent strings.Builder
-						tree.Files().ForEach(func(f *object.File) error {
-							content, err := f.Contents()
-							if err == nil {
-								allFileContent.WriteString(content)
-							}
-							return nil
-						})
-						diffText = allFileContent.String()
-					}
-				} else {
-					patch, err := parent.Patch(c)
-					if err == nil {
-						diffText = patch.String()
-					}
-				}
-			} else {
-				// Initial commit - get full content
-				tree, err := c.Tree()
-				if err == nil {
-					var allFileContent strings.Builder
-					tree.Files().ForEach(func(f *object.File) error {
-						content, err := f.Contents()
-						if err == nil {
-							allFileContent.WriteString(content)
-						}
-						return nil
-					})
-					diffText = allFileContent.String()
-				}
-			}
+	// Process each ref
+	for _, tip := range sortedValues(tips) {
+		c, err := repo.CommitObject(plumbing.NewHash(tip))
+		if err != nil {
+			return nil, fmt.Errorf("reading commit %s: %v", tip, err)
+		}
+		if scanned[c.Hash] {
+			continue
+		}
 
-			// Skip if no content to analyze
-			if diffText == "" {
-				return nil
+		commitIter := object.NewCommitPreorderIter(c, scanned, missing)
+		err = commitIter.ForEach(func(c *object.Commit) error {
+			scanned[c.Hash] = true
+			for _, parent := range c.ParentHashes {
+				children[parent] = append(children[parent], c.Hash)
 			}
 
-			// Look for secrets
-			secretsWithPatterns := scanDiffForSecrets(diffText, patterns, patternNames)
-			if len(secretsWithPatterns) == 0 {
+			// Without previous tips, only commits after the cutoff are new
+			if start.Tips == nil && !c.Committer.When.After(start.Since) {
 				return nil
 			}
 
-			// Associate secrets with files
-			var filePaths []string
-
-			// For regular commits, get file paths from patch
-			if c.NumParents() > 0 {
-				parent, err := c.Parent(0)
-				if err == nil {
-					patch, err := parent.Patch(c)
-					if err == nil {
-						for _, filePatch := range patch.FilePatches() {
-							from, to := filePatch.Files()
-							filePath := ""
-							if to != nil {
-								filePath = to.Path()
-							} else if from != nil {
-								filePath = from.Path()
-							}
-
-							if filePath != "" {
-								filePaths = append(filePaths, filePath)
-							}
-						}
-					}
-				}
-			}
-
-			// For initial commits or if patch doesn't work, get file paths from tree
-			if len(filePaths) == 0 {
-				tree, err := c.Tree()
-				if err == nil {
-					tree.Files().ForEach(func(f *object.File) error {
-						filePaths = append(filePaths, f.Name)
-						return nil
-					})
-				}
-			}
-
-			// If we still don't have file paths, use a placeholder
-			if len(filePaths) == 0 {
-				filePaths = append(filePaths, "unknown-file")
-			}
-
-			// For each secret, associate with files and track the oldest commit
-			for secret, patternName := range secretsWithPatterns {
-				if len(secret) > 500 {
+			// Look for secrets in each changed file, hunk by hunk
+			for _, hit := range scanCommitForSecrets(c, opts, rules) {
+				if hit.tooLong() {
 					continue
 				}
 
-				// Associate with each file
-				for _, filePath := range filePaths {
-					id := SecretIdentifier{
-						FilePath:    filePath,
-						Secret:      secret,
-						PatternName: patternName,
-					}
-
-					match := &SecretMatch{
-						Commit:      c,
-						PatternName: patternName,
-						Secret:      secret,
-						FilePath:    filePath,
-						RepoURL:     repoURL,
-						Found:       time.Now(),
-					}
+				id := SecretIdentifier{
+					FilePath:    hit.FilePath,
+					Secret:      hit.Secret,
+					PatternName: hit.Rule.Name,
+					Removed:     hit.Removed,
+				}
+				match := newSecretMatch(hit, c, repoURL, opts, allow)
 
-					existing, found := oldestCommits[id]
-					if !found || c.Committer.When.Before(existing.Commit.Committer.When) {
-						oldestCommits[id] = match
-					}
+				// Track the oldest commit that introduced (or removed) each secret
+				existing, found := oldestCommits[id]
+				if !found || c.Committer.When.Before(existing.CommitTime) {
+					oldestCommits[id] = match
 				}
 			}
 
 			return nil
 		})
+		commitIter.Close()
 
-		return err
-	})
+		if err != nil {
+			return nil, fmt.Errorf("walking history of %s: %v", tip, err)
+		}
+	}
 
-	// Send all secrets found
+	var commits []plumbing.Hash
 	for _, match := range oldestCommits {
-		resultsCh <- *match
+		commits = append(commits, plumbing.NewHash(match.CommitHash))
 	}
+	reaching := refsReaching(commits, tips, children)
 
-	// Clear maps to free memory
-	scanned = nil
-	oldestCommits = nil
-
-	// Force garbage collection to clean up memory
-	runtime.GC()
-
-	// Return the latest commit time we found
-	if latestCommitTime.IsZero() {
-		return since, err // No new commits found
+	matches := make([]*SecretMatch, 0, len(oldestCommits))
+	for _, match := range oldestCommits {
+		match.Refs = reaching[plumbing.NewHash(match.CommitHash)]
+		matches = append(matches, match)
 	}
-
-	return latestCommitTime, err
+	return matches, nil
 }
 
-func run() {
-	// Initialize count
-	count = 0
-
-	// Create persistent directories if they don't exist
-	if err := os.MkdirAll(reposDir, 0755); err != nil {
-		log.Fatalf("Failed to create repos directory: %v", err)
+// newSecretMatch turns a hit in commit c into a finding, suppressed if the
+// hit, the allowlist or the baseline says so
+func newSecretMatch(hit secretHit, c *object.Commit, repoURL string, opts scanOptions, allow *allowlist) *SecretMatch {
+	match := &SecretMatch{
+		CommitHash:  c.Hash.String(),
+		Author:      c.Author.Name,
+		AuthorEmail: c.Author.Email,
+		Date:        c.Author.When,
+		CommitTime:  c.Committer.When,
+		PatternName: hit.Rule.Name,
+		Confidence:  hit.Rule.Confidence,
+		RuleID:      hit.Rule.ID,
+		Severity:    hit.Rule.Severity,
+		Tags:        hit.Rule.Tags,
+		Description: hit.Rule.Description,
+		Remediation: hit.Rule.Remediation,
+		References:  hit.Rule.References,
+		Secret:      hit.Secret,
+		Fingerprint: secretFingerprint(hit.Secret),
+		Entropy:     hit.Entropy,
+		FilePath:    hit.FilePath,
+		Line:        hit.Line,
+		EndLine:     hit.EndLine,
+		EndColumn:   hit.endColumn(),
+		Column:      hit.Column,
+		Removed:     hit.Removed,
+		RepoURL:     repoURL,
+		Found:       time.Now(),
 	}
-
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("No .env file found or error loading it")
+	match.Suppressed = hit.Suppressed
+	if match.Suppressed == "" {
+		match.Suppressed = allow.suppress(*match)
 	}
-
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		log.Fatal("GITHUB_TOKEN is not set")
+	if match.Suppressed == "" && opts.Baseline.contains(*match) {
+		match.Suppressed = suppressedBaseline
+	}
+	if hit.Removed && len(c.ParentHashes) > 0 {
+		match.ParentHash = c.ParentHashes[0].String()
 	}
+	return match
+}
 
-	// Load state from previous run
-	state, err := loadState()
-	if err != nil {
-		log.Printf("Error loading state, starting from scratch: %v", err)
-		state = &ScanState{
-			LastRun:        time.Now().Add(-168 * time.Hour), // Default to 1 week ago
-			RepoLastCommit: make(map[string]time.Time),
+// reachableCommits returns the commits reachable from tips. Tips that are no
+// longer in the repository, e.g. after a force push and gc, are skipped:
+// their commits are scanned again if still reachable from a scanned ref.
+func reachableCommits(repo *git.Repository, tips map[string]string) (map[plumbing.Hash]bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	missing := shallowParents(repo)
+	for _, tip := range sortedValues(tips) {
+		c, err := repo.CommitObject(plumbing.NewHash(tip))
+		if err != nil {
+			continue
+		}
+		if seen[c.Hash] {
+			continue
 		}
-	}
 
-	patterns, patternNames, err := loadPatterns("rules.yml")
-	if err != nil {
-		log.Fatalf("Error loading patterns: %v", err)
+		err = object.NewCommitPreorderIter(c, seen, missing).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking history of %s: %v", tip, err)
+		}
 	}
+	return seen, nil
+}
 
-	org := "catalogfi"
-
-	repos, err := FetchCachedRepos()
-	if err != nil {
-		log.Fatalf("Error fetching repos for org %s: %v", org, err)
+// sortedValues returns the distinct values of m in order
+func sortedValues(m map[string]string) []string {
+	var values []string
+	for _, v := range m {
+		values = appendUnique(values, v)
 	}
+	sort.Strings(values)
+	return values
+}
+
+// RepoInfo describes a repository to scan and where it lives on disk
+type RepoInfo struct {
+	URL      string
+	LocalDir string
+}
 
+// scanRepos scans repositories with limited concurrency, each from the start
+// returned by startFor, and returns all findings together with the start of
+// the next scan per repository URL. A repository that fails to scan keeps its
+// start, so its commits are scanned again next time.
+func scanRepos(repoInfos []RepoInfo, concurrency int, startFor func(RepoInfo) scanStart, opts scanOptions, rules *patternSet) ([]SecretMatch, map[string]scanStart) {
 	resultsCh := make(chan SecretMatch, 100)
 	var allFindings []SecretMatch
 
@@ -526,10 +1053,116 @@ func run() {
 		}
 	}()
 
-	type RepoInfo struct {
-		URL      string
-		LocalDir string
-		Exists   bool
+	var scanWg sync.WaitGroup
+	var mu sync.Mutex
+	scanSem := make(chan struct{}, concurrency)
+	nextStart := make(map[string]scanStart)
+
+	for _, info := range repoInfos {
+		scanWg.Add(1)
+		go func(info RepoInfo) {
+			defer scanWg.Done()
+
+			scanSem <- struct{}{}
+			defer func() { <-scanSem }()
+
+			start := startFor(info)
+
+			// Scan the repo for secrets since last check
+			if opts.Mode == scanModeTree {
+				fmt.Printf("Scanning repository %s (files at ref tips)...\n", info.URL)
+			} else {
+				fmt.Printf("Scanning repository %s (%s)...\n", info.URL, start)
+			}
+
+			tips, err := scanRepoForSecrets(
+				info.LocalDir,
+				info.URL,
+				start,
+				opts,
+				rules,
+				resultsCh,
+			)
+
+			if err != nil {
+				log.Printf("Error scanning repository %s: %v", info.URL, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Save the scanned tips for this repo
+			if err == nil {
+				nextStart[info.URL] = scanStart{Tips: tips}
+			} else {
+				nextStart[info.URL] = start
+			}
+
+			count++
+		}(info)
+	}
+
+	scanWg.Wait()
+	close(resultsCh)
+	resultsWg.Wait()
+
+	return allFindings, nextStart
+}
+
+// run scans every configured target and returns all new findings
+func run(opts *Config, scanOpts scanOptions) []SecretMatch {
+	targets, err := parseTargets(opts.Orgs, opts.Users)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		fmt.Println("No .env file found or error loading it")
+	}
+
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		log.Fatal("GITHUB_TOKEN is not set")
+	}
+
+	rules := loadScanRules(opts, scanOpts)
+
+	// Each target keeps its own cache, state, findings and report
+	var findings []SecretMatch
+	for _, target := range targets {
+		fmt.Printf("Scanning target %s\n", target)
+		findings = append(findings, scanTarget(opts, scanOpts, target, token, rules)...)
+	}
+
+	return findings
+}
+
+// scanTarget clones, updates and scans all cached repositories of one target
+func scanTarget(opts *Config, scanOpts scanOptions, target local.Target, token string, rules *patternSet) []SecretMatch {
+	// Initialize count
+	count = 0
+
+	statePath := targetFile(opts.StateFile, target)
+	outputPath := targetFile(opts.OutputFile, target)
+	findingsPath := targetFile(opts.FindingsFile, target)
+	targetReposDir := filepath.Join(opts.ReposDir, target.Slug())
+
+	// Create persistent directories if they don't exist
+	if err := os.MkdirAll(targetReposDir, 0755); err != nil {
+		log.Fatalf("Failed to create repos directory: %v", err)
+	}
+
+	// Load state from previous run
+	state, err := loadState(statePath)
+	if err != nil {
+		log.Printf("Error loading state, starting from scratch: %v", err)
+		state = newScanState(time.Time{})
+	}
+
+	repos, err := FetchCachedRepos(targetFile(opts.CacheFile, target))
+	if err != nil {
+		log.Printf("Error fetching repos for %s: %v", target, err)
+		return nil
 	}
 
 	var repoInfos []RepoInfo
@@ -545,25 +1178,22 @@ func run() {
 			continue
 		}
 
-		// Create a normalized repo directory name from the URL
-		repoName := strings.TrimSuffix(filepath.Base(cloneURL), ".git")
-		repoDir := filepath.Join(reposDir, repoName)
-
-		exists := false
-		if _, err := os.Stat(repoDir); !os.IsNotExist(err) {
-			exists = true
-		}
-
 		repoInfos = append(repoInfos, RepoInfo{
 			URL:      cloneURL,
-			LocalDir: repoDir,
-			Exists:   exists,
+			LocalDir: mirrorDir(targetReposDir, opts.ReposDir, cloneURL),
 		})
 	}
 
-	// Clone or update repositories with limited concurrency
+	// Clone or update the mirrors with limited concurrency
 	var repoWg sync.WaitGroup
-	repoSem := make(chan struct{}, scanConcurrency)
+	repoSem := make(chan struct{}, opts.Concurrency)
+
+	syncOpts := syncOptions{
+		Token:     token,
+		SinceDate: scanOpts.SinceDate,
+		Depth:     scanOpts.Depth,
+		Pull:      contains(scanOpts.RefScopes, refScopePull),
+	}
 
 	for _, info := range repoInfos {
 		repoWg.Add(1)
@@ -573,59 +1203,9 @@ func run() {
 			repoSem <- struct{}{}
 			defer func() { <-repoSem }()
 
-			auth := &http.BasicAuth{
-				Username: "username", // Username doesn't matter for GitHub token auth
-				Password: token,
-			}
-
-			if info.Exists {
-				// Update existing repository
-				fmt.Printf("Updating repository %s...\n", info.URL)
-
-				repo, err := git.PlainOpen(info.LocalDir)
-				if err != nil {
-					log.Printf("Error opening repository %s: %v", info.URL, err)
-					return
-				}
-
-				// Fetch updates for all branches
-				err = repo.Fetch(&git.FetchOptions{
-					RefSpecs: []config.RefSpec{config.RefSpec("+refs/heads/*:refs/remotes/origin/*")},
-					Auth:     auth,
-					Force:    true,
-				})
-
-				if err != nil && err != git.NoErrAlreadyUpToDate {
-					log.Printf("Error fetching updates for repository %s: %v", info.URL, err)
-				}
-
-				// Attempt to pull updates for the current branch
-				w, err := repo.Worktree()
-				if err != nil {
-					log.Printf("Error getting worktree for repository %s: %v", info.URL, err)
-				} else {
-					err = w.Pull(&git.PullOptions{
-						RemoteName: "origin",
-						Auth:       auth,
-					})
-					if err != nil && err != git.NoErrAlreadyUpToDate {
-						log.Printf("Error pulling updates for repository %s: %v", info.URL, err)
-					}
-				}
-			} else {
-				// Clone new repository
-				fmt.Printf("Cloning repository %s...\n", info.URL)
-
-				_, err := git.PlainClone(info.LocalDir, false, &git.CloneOptions{
-					URL:      info.URL,
-					Auth:     auth,
-					Progress: os.Stdout,
-				})
-
-				if err != nil {
-					log.Printf("Error cloning repository %s: %v", info.URL, err)
-					return
-				}
+			fmt.Printf("Syncing repository %s...\n", info.URL)
+			if err := syncMirror(info.LocalDir, info.URL, syncOpts); err != nil {
+				log.Printf("Error syncing repository %s: %v", info.URL, err)
 			}
 		}(info)
 	}
@@ -633,74 +1213,50 @@ func run() {
 	repoWg.Wait()
 	fmt.Printf("Processed %d repositories\n", len(repoInfos))
 
-	// Now scan repositories with limited concurrency
-	var scanWg sync.WaitGroup
-	scanSem := make(chan struct{}, scanConcurrency)
-
 	// Create a new state to track this run
-	newState := &ScanState{
-		LastRun:        time.Now(),
-		RepoLastCommit: make(map[string]time.Time),
-	}
-
-	for _, info := range repoInfos {
-		scanWg.Add(1)
-		go func(info RepoInfo) {
-			defer scanWg.Done()
-
-			scanSem <- struct{}{}
-			defer func() { <-scanSem }()
-
-			// Get the time since which we should scan
-			since := state.LastRun
-			if lastCommit, ok := state.RepoLastCommit[info.URL]; ok && lastCommit.After(since) {
-				since = lastCommit
-			}
-
-			// Scan the repo for secrets since last check
-			fmt.Printf("Scanning repository %s (changes since %s)...\n",
-				info.URL, since.Format("2006-01-02 15:04:05"))
-
-			lastCommitTime, err := scanRepoForSecrets(
-				info.LocalDir,
-				info.URL,
-				since,
-				patterns,
-				patternNames,
-				resultsCh,
-			)
+	newState := newScanState(time.Now())
 
-			if err != nil {
-				log.Printf("Error scanning repository %s: %v", info.URL, err)
-			}
+	startFor := func(info RepoInfo) scanStart {
+		if scanOpts.FullHistory {
+			return scanStart{}
+		}
+		return state.startFor(info.URL)
+	}
 
-			// Save the latest commit time for this repo
-			if lastCommitTime.After(since) {
-				newState.RepoLastCommit[info.URL] = lastCommitTime
-			} else {
-				newState.RepoLastCommit[info.URL] = since
-			}
+	allFindings, nextStart := scanRepos(repoInfos, opts.Concurrency, startFor, scanOpts, rules)
+	for repoURL, start := range nextStart {
+		newState.record(repoURL, start)
+	}
 
-			count++
-		}(info)
+	if len(scanOpts.Verify) > 0 {
+		allFindings = verifyFindings(allFindings, scanOpts)
 	}
 
-	scanWg.Wait()
-	close(resultsCh)
-	resultsWg.Wait()
+	// Keep findings so the report can be regenerated later. Tree findings
+	// are attributed to the ref tips rather than the commits that added the
+	// secrets, so they would duplicate the history findings.
+	if scanOpts.Mode != scanModeTree {
+		if err := appendFindings(findingsPath, allFindings); err != nil {
+			log.Printf("Error saving findings: %v", err)
+		}
+	}
 
 	// Write findings to report
-	if err := appendToReport(allFindings); err != nil {
+	if err := writeScanOutput(opts.Format, outputPath, allFindings); err != nil {
 		log.Printf("Error writing report: %v", err)
 	} else {
-		log.Printf("Updated findings in %s", outputFile)
+		log.Printf("Updated findings in %s", outputPath)
 	}
 
-	// Save state for next run
-	if err := saveState(newState); err != nil {
-		log.Printf("Error saving state: %v", err)
+	// Save state for next run; tree scans don't scan new commits
+	if scanOpts.Mode != scanModeTree {
+		if err := saveState(statePath, newState); err != nil {
+			log.Printf("Error saving state: %v", err)
+		}
 	}
 
 	fmt.Printf("Scanned %d repositories\n", count)
 	fmt.Println("Scanning complete.")
+
+	return allFindings
 }
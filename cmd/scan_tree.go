@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Scan modes selected with scan --mode
+const (
+	scanModeHistory = "history" // Lines added by each new commit
+	scanModeTree    = "tree"    // Files at each ref tip
+)
+
+// scanModes lists the valid values of scan --mode
+var scanModes = []string{scanModeHistory, scanModeTree}
+
+// Values of SecretMatch.HeadStatus
+const (
+	headPresent = "present" // The file at HEAD still has the secret
+	headRemoved = "removed" // The file at HEAD no longer has the secret, or is gone
+)
+
+// scanTreesForSecrets scans the files at each ref tip. A secret found at the
+// same place in several refs is reported once, for the commit of the first
+// ref by name, and lists all of them. Blobs shared by refs are scanned once.
+func scanTreesForSecrets(repo *git.Repository, repoURL string, tips map[string]string, opts scanOptions, rules *patternSet, allow *allowlist) ([]*SecretMatch, error) {
+	var refs []string
+	for ref := range tips {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	blobHits := make(map[plumbing.Hash][]secretHit)
+	found := make(map[string]*SecretMatch)
+	var matches []*SecretMatch
+
+	for _, ref := range refs {
+		c, err := repo.CommitObject(plumbing.NewHash(tips[ref]))
+		if err != nil {
+			return nil, fmt.Errorf("reading commit %s: %v", tips[ref], err)
+		}
+
+		tree, err := c.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("reading tree of %s: %v", ref, err)
+		}
+
+		err = tree.Files().ForEach(func(f *object.File) error {
+			hits, ok := blobHits[f.Hash]
+			if !ok {
+				hits = scanFileForSecrets(f, rules)
+				blobHits[f.Hash] = hits
+			}
+
+			for _, hit := range hits {
+				if hit.tooLong() {
+					continue
+				}
+				hit.FilePath = f.Name
+
+				key := strings.Join([]string{hit.FilePath, strconv.Itoa(hit.Line), strconv.Itoa(hit.Column), hit.Rule.ID, hit.Secret}, "\x00")
+				if match, ok := found[key]; ok {
+					match.Refs = appendUnique(match.Refs, ref)
+					continue
+				}
+
+				match := newSecretMatch(hit, c, repoURL, opts, allow)
+				match.Refs = []string{ref}
+				found[key] = match
+				matches = append(matches, match)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading files of %s: %v", ref, err)
+		}
+	}
+
+	return matches, nil
+}
+
+// markHeadStatus records for each finding whether the file it was found in
+// still has the secret at HEAD. Findings are left unmarked if the repository
+// has no HEAD commit.
+func markHeadStatus(repo *git.Repository, matches []*SecretMatch) {
+	if len(matches) == 0 {
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return
+	}
+	c, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return
+	}
+
+	contents := make(map[string]string)
+	for _, match := range matches {
+		content, ok := contents[match.FilePath]
+		if !ok {
+			if f, err := tree.File(match.FilePath); err == nil {
+				content, _ = f.Contents()
+			}
+			contents[match.FilePath] = content
+		}
+
+		match.HeadStatus = headRemoved
+		if strings.Contains(content, match.Secret) {
+			match.HeadStatus = headPresent
+		}
+	}
+}
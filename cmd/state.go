@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var stateResetRepos []string
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect and edit the scan state",
+	Long: `The scan state of each --org and --user target, e.g.
+scan_state.org-catalogfi.json, records the tips of the refs every repository
+was scanned up to. The next scan only covers commits that aren't reachable
+from those tips; repositories missing from the state get a full-history scan.`,
+}
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the scanned ref tips of every repository",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := parseTargets(cfg.Orgs, cfg.Users)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, target := range targets {
+			statePath := targetFile(cfg.StateFile, target)
+			if _, err := os.Stat(statePath); os.IsNotExist(err) {
+				fmt.Printf("%s: %s (not found, every repository gets a full-history scan)\n", target, statePath)
+				continue
+			}
+
+			state, err := loadState(statePath)
+			if err != nil {
+				log.Fatalf("Error loading state for %s: %v", target, err)
+			}
+
+			fmt.Printf("%s: %s, last run %s\n", target, statePath, state.LastRun.Format("2006-01-02 15:04:05"))
+
+			var repos []string
+			for repoURL := range state.RepoTips {
+				repos = append(repos, repoURL)
+			}
+			for repoURL := range state.RepoLastCommit {
+				repos = append(repos, repoURL)
+			}
+			sort.Strings(repos)
+
+			for _, repoURL := range repos {
+				fmt.Printf("  %s\n", repoURL)
+				if cutoff, ok := state.RepoLastCommit[repoURL]; ok {
+					fmt.Printf("    commits after %s\n", cutoff.Format("2006-01-02 15:04:05"))
+					continue
+				}
+
+				tips := state.RepoTips[repoURL]
+				var refs []string
+				for ref := range tips {
+					refs = append(refs, ref)
+				}
+				sort.Strings(refs)
+				for _, ref := range refs {
+					fmt.Printf("    %s %s\n", tips[ref], ref)
+				}
+			}
+		}
+	},
+}
+
+var stateResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Forget repositories so their full history is scanned again",
+	Long: `Reset removes the given repositories from the scan state of every --org and
+--user target that has them, so the next scan covers their full history.
+Repositories are named by their clone URL as printed by "state show".`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(stateResetRepos) == 0 {
+			return fmt.Errorf("no repositories given, use --repo <url>")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := parseTargets(cfg.Orgs, cfg.Users)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		found := make(map[string]bool)
+		for _, target := range targets {
+			statePath := targetFile(cfg.StateFile, target)
+			if _, err := os.Stat(statePath); os.IsNotExist(err) {
+				continue
+			}
+
+			state, err := loadState(statePath)
+			if err != nil {
+				log.Fatalf("Error loading state for %s: %v", target, err)
+			}
+
+			changed := false
+			for _, repoURL := range stateResetRepos {
+				if state.reset(repoURL) {
+					fmt.Printf("Reset %s in %s\n", repoURL, statePath)
+					found[repoURL] = true
+					changed = true
+				}
+			}
+
+			if changed {
+				if err := saveState(statePath, state); err != nil {
+					log.Fatalf("Error saving state for %s: %v", target, err)
+				}
+			}
+		}
+
+		missing := 0
+		for _, repoURL := range stateResetRepos {
+			if !found[repoURL] {
+				log.Printf("%s is not in the scan state of any target", repoURL)
+				missing++
+			}
+		}
+		if missing > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateResetCmd)
+
+	stateResetCmd.Flags().StringSliceVar(&stateResetRepos, "repo", nil, "clone URL of a repository to reset (repeatable)")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"secretsanta-cli/local"
+)
+
+// parseTargets builds the list of scan targets from the configured orgs and users
+func parseTargets(orgs, users []string) ([]local.Target, error) {
+	var targets []local.Target
+	seen := make(map[local.Target]bool)
+
+	add := func(kind string, names []string) {
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			target := local.Target{Kind: kind, Name: name}
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	add(local.TargetOrg, orgs)
+	add(local.TargetUser, users)
+
+	if len(targets) == 0 {
+		return nil, errors.New("no targets given, use --org/--user or set orgs/users in the config file")
+	}
+
+	return targets, nil
+}
+
+// targetFile derives the per-target variant of a file name by inserting the
+// target slug before the extension, e.g. scan_state.json -> scan_state.org-foo.json
+func targetFile(path string, target local.Target) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + target.Slug() + ext
+}
@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Verification results recorded in SecretMatch.Verified
+const (
+	verifiedLive    = "live"
+	verifiedRevoked = "revoked"
+	verifiedUnknown = "unknown"
+)
+
+// verifyAll enables every verifier in --verify
+const verifyAll = "all"
+
+// verifyTimeout bounds a single verification request
+const verifyTimeout = 10 * time.Second
+
+// verifier checks whether a credential found by one provider's rules is still valid
+type verifier struct {
+	provider   string
+	baseURL    string         // Default API endpoint, overridable with --verify-url
+	names      *regexp.Regexp // Pattern names whose findings are dispatched to this verifier
+	credential *regexp.Regexp // Extracts the credential from the matched secret
+	// check returns live, revoked or unknown. related are the other findings
+	// of the same commit and file, for credentials that come in pairs.
+	check func(client *http.Client, baseURL, credential string, related []SecretMatch) (string, error)
+}
+
+var verifiers = []*verifier{
+	{
+		provider:   "github",
+		baseURL:    "https://api.github.com",
+		names:      regexp.MustCompile(`(?i)^github`),
+		credential: regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,255}`),
+		check:      checkGitHubToken,
+	},
+	{
+		provider:   "slack",
+		baseURL:    "https://slack.com/api",
+		names:      regexp.MustCompile(`(?i)^slack`),
+		credential: regexp.MustCompile(`xox[abposr]-[0-9A-Za-z-]{10,}`),
+		check:      checkSlackToken,
+	},
+	{
+		provider:   "aws",
+		baseURL:    "https://sts.amazonaws.com",
+		names:      regexp.MustCompile(`(?i)^(aws|amazon)`),
+		credential: regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),
+		check:      checkAWSKey,
+	},
+	{
+		provider:   "infura",
+		baseURL:    "https://mainnet.infura.io/v3",
+		names:      regexp.MustCompile(`(?i)infura`),
+		credential: regexp.MustCompile(`infura\.io/v[0-9]+/([0-9A-Za-z]+)`),
+		check:      checkEthereumRPC,
+	},
+	{
+		provider:   "alchemy",
+		baseURL:    "https://eth-mainnet.g.alchemy.com/v2",
+		names:      regexp.MustCompile(`(?i)alchemy`),
+		credential: regexp.MustCompile(`alchemy\.com/v[0-9]+/([0-9A-Za-z_-]+)`),
+		check:      checkEthereumRPC,
+	},
+}
+
+// verifierProviders returns the names of all verifiers
+func verifierProviders() []string {
+	providers := make([]string, 0, len(verifiers))
+	for _, v := range verifiers {
+		providers = append(providers, v.provider)
+	}
+	return providers
+}
+
+// validateVerifyOptions checks the providers and base URL overrides given on the command line
+func validateVerifyOptions(providers []string, urls map[string]string) error {
+	known := verifierProviders()
+	for _, provider := range providers {
+		if provider != verifyAll && !contains(known, provider) {
+			return fmt.Errorf("unknown --verify provider %q, must be %s or %s", provider, verifyAll, strings.Join(known, ", "))
+		}
+	}
+	for provider, baseURL := range urls {
+		if !contains(known, provider) {
+			return fmt.Errorf("unknown --verify-url provider %q", provider)
+		}
+		if u, err := url.Parse(baseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid --verify-url for %s: %q", provider, baseURL)
+		}
+	}
+	return nil
+}
+
+// rateLimiter spaces out requests to one provider
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next request may be sent
+func (r *rateLimiter) wait() {
+	now := time.Now()
+	if r.next.After(now) {
+		time.Sleep(r.next.Sub(now))
+		now = r.next
+	}
+	r.next = now.Add(r.interval)
+}
+
+// verifyFindings checks the credentials of active findings against the
+// enabled providers and records the result in Verified. Each credential is
+// only checked once per run.
+func verifyFindings(findings []SecretMatch, opts scanOptions) []SecretMatch {
+	enabled := make(map[string]bool)
+	for _, provider := range opts.Verify {
+		enabled[provider] = true
+	}
+
+	interval := time.Duration(0)
+	if opts.VerifyRate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.VerifyRate)
+	}
+
+	client := &http.Client{Timeout: verifyTimeout}
+	limiters := make(map[string]*rateLimiter)
+	results := make(map[string]string)
+
+	// Findings of the same commit and file, for verifiers that need a pair
+	relatedKey := func(match SecretMatch) string {
+		return match.RepoURL + "\x00" + match.CommitHash + "\x00" + match.FilePath
+	}
+	related := make(map[string][]SecretMatch)
+	for _, match := range findings {
+		related[relatedKey(match)] = append(related[relatedKey(match)], match)
+	}
+
+	verified := 0
+	for i := range findings {
+		match := &findings[i]
+		if match.Suppressed != "" {
+			continue
+		}
+
+		for _, v := range verifiers {
+			if !enabled[verifyAll] && !enabled[v.provider] {
+				continue
+			}
+			if !v.names.MatchString(match.PatternName) {
+				continue
+			}
+
+			credential := v.extract(match.Secret)
+			if credential == "" {
+				continue
+			}
+
+			cacheKey := v.provider + "\x00" + credential
+			result, ok := results[cacheKey]
+			if !ok {
+				limiter := limiters[v.provider]
+				if limiter == nil {
+					limiter = &rateLimiter{interval: interval}
+					limiters[v.provider] = limiter
+				}
+				limiter.wait()
+
+				baseURL := v.baseURL
+				if override, ok := opts.VerifyURLs[v.provider]; ok {
+					baseURL = override
+				}
+
+				var err error
+				result, err = v.check(client, strings.TrimRight(baseURL, "/"), credential, related[relatedKey(*match)])
+				if err != nil {
+					log.Printf("Error verifying %s finding in %s: %v", v.provider, match.FilePath, err)
+					result = verifiedUnknown
+				}
+				results[cacheKey] = result
+			}
+
+			match.Verified = result
+			verified++
+			break
+		}
+	}
+
+	fmt.Printf("Verified %d findings (%d distinct credentials)\n", verified, len(results))
+	return findings
+}
+
+// extract returns the credential in a matched secret, or "" if there is none
+func (v *verifier) extract(secret string) string {
+	m := v.credential.FindStringSubmatch(secret)
+	if m == nil {
+		return ""
+	}
+	if len(m) > 1 {
+		return m[1]
+	}
+	return m[0]
+}
+
+// statusResult maps an HTTP status to a verification result
+func statusResult(status int) string {
+	switch {
+	case status >= 200 && status < 300:
+		return verifiedLive
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return verifiedRevoked
+	default:
+		return verifiedUnknown
+	}
+}
+
+// checkGitHubToken calls GET /user with the token
+func checkGitHubToken(client *http.Client, baseURL, token string, _ []SecretMatch) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/user", nil)
+	if err != nil {
+		return verifiedUnknown, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return verifiedUnknown, err
+	}
+	defer resp.Body.Close()
+
+	return statusResult(resp.StatusCode), nil
+}
+
+// checkSlackToken calls auth.test, which answers 200 with ok:false for bad tokens
+func checkSlackToken(client *http.Client, baseURL, token string, _ []SecretMatch) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/auth.test", nil)
+	if err != nil {
+		return verifiedUnknown, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return verifiedUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusResult(resp.StatusCode), nil
+	}
+
+	var body struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return verifiedUnknown, fmt.Errorf("error decoding auth.test response: %v", err)
+	}
+
+	if body.OK {
+		return verifiedLive, nil
+	}
+	switch body.Error {
+	case "invalid_auth", "not_authed", "token_revoked", "token_expired", "account_inactive":
+		return verifiedRevoked, nil
+	}
+	return verifiedUnknown, nil
+}
+
+// awsSecretKey matches an AWS secret access key
+var awsSecretKey = regexp.MustCompile(`(?:^|[^A-Za-z0-9/+])([A-Za-z0-9/+]{40})(?:$|[^A-Za-z0-9/+=])`)
+
+// checkAWSKey calls STS GetCallerIdentity. An access key ID can only be
+// checked together with its secret key, which is looked up among the other
+// findings of the same commit and file, e.g. from --entropy.
+func checkAWSKey(client *http.Client, baseURL, keyID string, related []SecretMatch) (string, error) {
+	var secrets []string
+	for _, match := range related {
+		if m := awsSecretKey.FindStringSubmatch(match.Secret); m != nil && !contains(secrets, m[1]) {
+			secrets = append(secrets, m[1])
+		}
+	}
+	sort.Strings(secrets)
+
+	for _, secret := range secrets {
+		body := "Action=GetCallerIdentity&Version=2011-06-15"
+		req, err := http.NewRequest(http.MethodPost, baseURL+"/", strings.NewReader(body))
+		if err != nil {
+			return verifiedUnknown, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signAWSRequest(req, body, keyID, secret, time.Now().UTC())
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return verifiedUnknown, err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return verifiedLive, nil
+		}
+		// A wrong secret key only says the pair doesn't match; an unknown
+		// key ID means the key was deleted or deactivated
+		if bytes.Contains(respBody, []byte("InvalidClientTokenId")) {
+			return verifiedRevoked, nil
+		}
+	}
+	return verifiedUnknown, nil
+}
+
+// signAWSRequest adds an AWS Signature Version 4 for STS in us-east-1
+func signAWSRequest(req *http.Request, body, keyID, secret string, now time.Time) {
+	const region, service = "us-east-1", "sts"
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := sha256.Sum256([]byte(body))
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-date:" + amzDate,
+		"",
+		"content-type;host;x-amz-date",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host;x-amz-date, Signature=%s", keyID, scope, signature))
+}
+
+// hmacSHA256 returns HMAC-SHA256(key, data)
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// checkEthereumRPC calls eth_chainId on an Infura or Alchemy endpoint for the project key
+func checkEthereumRPC(client *http.Client, baseURL, key string, _ []SecretMatch) (string, error) {
+	payload := `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`
+	resp, err := client.Post(baseURL+"/"+key, "application/json", strings.NewReader(payload))
+	if err != nil {
+		return verifiedUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusResult(resp.StatusCode), nil
+	}
+
+	var body struct {
+		Result string          `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return verifiedUnknown, fmt.Errorf("error decoding eth_chainId response: %v", err)
+	}
+
+	if body.Result != "" {
+		return verifiedLive, nil
+	}
+	return verifiedUnknown, nil
+}
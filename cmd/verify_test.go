@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckGitHubToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" {
+			t.Errorf("got request for %s, want /user", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "token good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login":"octocat"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"good", verifiedLive},
+		{"bad", verifiedRevoked},
+	}
+	for _, tt := range tests {
+		got, err := checkGitHubToken(server.Client(), server.URL, tt.token, nil)
+		if err != nil {
+			t.Fatalf("checkGitHubToken(%q): %v", tt.token, err)
+		}
+		if got != tt.want {
+			t.Errorf("checkGitHubToken(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSlackToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth.test" {
+			t.Errorf("got request for %s, want /auth.test", r.URL.Path)
+		}
+		// auth.test answers 200 for bad tokens too
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Write([]byte(`{"ok":true}`))
+		case "Bearer revoked":
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+		default:
+			w.Write([]byte(`{"ok":false,"error":"ratelimited"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"good", verifiedLive},
+		{"revoked", verifiedRevoked},
+		{"other", verifiedUnknown},
+	}
+	for _, tt := range tests {
+		got, err := checkSlackToken(server.Client(), server.URL, tt.token, nil)
+		if err != nil {
+			t.Fatalf("checkSlackToken(%q): %v", tt.token, err)
+		}
+		if got != tt.want {
+			t.Errorf("checkSlackToken(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestCheckAWSKey(t *testing.T) {
+	const secret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "Action=GetCallerIdentity") {
+			t.Errorf("got body %q, want a GetCallerIdentity call", body)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+			t.Errorf("request is not signed: %q", r.Header.Get("Authorization"))
+		}
+
+		if strings.Contains(r.Header.Get("Authorization"), "Credential=AKIALIVE") {
+			w.Write([]byte(`<GetCallerIdentityResponse/>`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<ErrorResponse><Error><Code>InvalidClientTokenId</Code></Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+
+	related := []SecretMatch{{Secret: `aws_secret_access_key = "` + secret + `"`}}
+
+	tests := []struct {
+		keyID   string
+		related []SecretMatch
+		want    string
+	}{
+		{"AKIALIVE", related, verifiedLive},
+		{"AKIADELETED", related, verifiedRevoked},
+		// Without a secret key there is nothing to check
+		{"AKIALIVE", nil, verifiedUnknown},
+	}
+	for _, tt := range tests {
+		got, err := checkAWSKey(server.Client(), server.URL, tt.keyID, tt.related)
+		if err != nil {
+			t.Fatalf("checkAWSKey(%q): %v", tt.keyID, err)
+		}
+		if got != tt.want {
+			t.Errorf("checkAWSKey(%q, %d related) = %s, want %s", tt.keyID, len(tt.related), got, tt.want)
+		}
+	}
+}
+
+func TestCheckEthereumRPC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"method":"eth_chainId"`) {
+			t.Errorf("got body %q, want an eth_chainId call", body)
+		}
+
+		if r.URL.Path != "/goodkey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"goodkey", verifiedLive},
+		{"badkey", verifiedRevoked},
+	}
+	for _, tt := range tests {
+		got, err := checkEthereumRPC(server.Client(), server.URL, tt.key, nil)
+		if err != nil {
+			t.Fatalf("checkEthereumRPC(%q): %v", tt.key, err)
+		}
+		if got != tt.want {
+			t.Errorf("checkEthereumRPC(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyFindingsRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	findings := []SecretMatch{
+		{PatternName: "Github Personal Access Token", Secret: "ghp_" + strings.Repeat("a", 36)},
+		{PatternName: "Github Personal Access Token", Secret: "ghp_" + strings.Repeat("b", 36)},
+		{PatternName: "Github Personal Access Token", Secret: "ghp_" + strings.Repeat("c", 36)},
+		// Checked once per run
+		{PatternName: "Github Personal Access Token", Secret: "ghp_" + strings.Repeat("a", 36)},
+	}
+
+	const rate = 20
+	opts := scanOptions{
+		Verify:     []string{"github"},
+		VerifyURLs: map[string]string{"github": server.URL},
+		VerifyRate: rate,
+	}
+	findings = verifyFindings(findings, opts)
+
+	for i, match := range findings {
+		if match.Verified != verifiedRevoked {
+			t.Errorf("finding %d verified as %q, want %s", i, match.Verified, verifiedRevoked)
+		}
+	}
+
+	if len(times) != 3 {
+		t.Fatalf("got %d requests, want 3", len(times))
+	}
+	// Allow for timer granularity
+	minGap := time.Second/rate - 5*time.Millisecond
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < minGap {
+			t.Errorf("request %d sent %v after the previous one, want at least %v", i, gap, minGap)
+		}
+	}
+}
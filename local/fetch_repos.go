@@ -12,10 +12,8 @@ import (
 	"golang.org/x/oauth2"
 )
 
-const reposCache = "cached_repos.json"
-
 // StoreReposToCache saves repository data to JSON file
-func StoreReposToCache(repos []*github.Repository) error {
+func StoreReposToCache(reposCache string, repos []*github.Repository) error {
 	data, err := json.MarshalIndent(repos, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling repos: %v", err)
@@ -29,8 +27,9 @@ func StoreReposToCache(repos []*github.Repository) error {
 	return nil
 }
 
-// FetchAndCacheRepos fetches repositories and stores them in cache
-func FetchAndCacheRepos() {
+// FetchAndCacheRepos fetches repositories of each target and stores them in
+// that target's cache file, as returned by cacheFile
+func FetchAndCacheRepos(targets []Target, cacheFile func(Target) string) {
 	if err := godotenv.Load(); err != nil {
 		fmt.Println("No .env file found or error loading it")
 	}
@@ -44,20 +43,30 @@ func FetchAndCacheRepos() {
 	tc := oauth2.NewClient(context.Background(), ts)
 	ghClient := github.NewClient(tc)
 
-	org := "catalogfi"
+	for _, target := range targets {
+		var repos []*github.Repository
+		var err error
+
+		// Organizations and users are listed through different endpoints
+		switch target.Kind {
+		case TargetOrg:
+			repos, err = fetchOrgRepos(ghClient, target.Name)
+		case TargetUser:
+			repos, err = fetchUserRepos(ghClient, target.Name)
+		default:
+			err = fmt.Errorf("unknown target kind %q", target.Kind)
+		}
+		if err != nil {
+			log.Fatalf("Error fetching repos for %s: %v", target, err)
+		}
 
-	// Use the original fetchOrgRepos to get data from GitHub
-	repos, err := fetchOrgRepos(ghClient, org)
-	if err != nil {
-		log.Fatalf("Error fetching repos for org %s: %v", org, err)
-	}
+		// Store the results in cache
+		if err := StoreReposToCache(cacheFile(target), repos); err != nil {
+			log.Fatalf("Error caching repos: %v", err)
+		}
 
-	// Store the results in cache
-	if err := StoreReposToCache(repos); err != nil {
-		log.Fatalf("Error caching repos: %v", err)
+		fmt.Printf("Successfully cached %d repositories for %s\n", len(repos), target)
 	}
-
-	fmt.Printf("Successfully cached %d repositories\n", len(repos))
 }
 
 func fetchOrgRepos(client *github.Client, org string) ([]*github.Repository, error) {
@@ -82,3 +91,27 @@ func fetchOrgRepos(client *github.Client, org string) ([]*github.Repository, err
 
 	return allRepos, nil
 }
+
+func fetchUserRepos(client *github.Client, user string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	opts := &github.RepositoryListOptions{
+		Type:        "owner",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	for {
+		repos, resp, err := client.Repositories.List(context.Background(), user, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		allRepos = append(allRepos, repos...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return allRepos, nil
+}
@@ -0,0 +1,25 @@
+package local
+
+import "fmt"
+
+// Target kinds supported by the GitHub API listing
+const (
+	TargetOrg  = "org"
+	TargetUser = "user"
+)
+
+// Target is a GitHub organization or user account whose repositories are scanned
+type Target struct {
+	Kind string
+	Name string
+}
+
+// String returns the target in "kind/name" form
+func (t Target) String() string {
+	return fmt.Sprintf("%s/%s", t.Kind, t.Name)
+}
+
+// Slug returns an identifier for the target that is safe to use in file names
+func (t Target) Slug() string {
+	return fmt.Sprintf("%s-%s", t.Kind, t.Name)
+}
@@ -0,0 +1,11 @@
+// Package ruleset holds the default secret detection rules, which are built
+// into the binary so it works from any directory.
+package ruleset
+
+import _ "embed"
+
+// Default is the built-in rules file. Rules files passed with --rules can
+// start from it with "extends: default" and override its rules by id.
+//
+//go:embed rules.yml
+var Default []byte